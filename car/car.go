@@ -0,0 +1,377 @@
+package car
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/filswan/go-swan-lib/commp"
+	"github.com/filswan/go-swan-lib/logs"
+	"github.com/filswan/go-swan-lib/model"
+
+	"github.com/ipfs/go-cid"
+	chunker "github.com/ipfs/go-ipfs-chunker"
+	ipld "github.com/ipfs/go-ipld-format"
+	"github.com/ipfs/go-merkledag"
+	"github.com/ipfs/go-unixfs"
+	"github.com/ipfs/go-unixfs/importer/balanced"
+	"github.com/ipfs/go-unixfs/importer/helpers"
+	"github.com/ipfs/go-unixfs/importer/trickle"
+	uio "github.com/ipfs/go-unixfs/io"
+	"github.com/multiformats/go-multihash"
+)
+
+const (
+	CAR_VERSION_1 = 1
+	CAR_VERSION_2 = 2
+
+	CAR_FILE_EXTENSION    = ".car"
+	CHUNKER_DEFAULT       = "size-1048576"
+	HASH_FUNCTION_DEFAULT = "sha2-256"
+)
+
+type CarOptions struct {
+	Chunker      string // go-ipfs-chunker spec, such as size-262144 or rabin-262144-524288-1048576, empty means CHUNKER_DEFAULT
+	RawLeaves    bool   // file data in raw blocks instead of unixfs nodes, it needs cid version 1
+	CidVersion   int    // 0 or 1
+	HashFunction string // multihash name, empty means HASH_FUNCTION_DEFAULT
+	MaxLinks     int    // max links of an intermediate file node, 0 means helpers.DefaultLinksPerBlock
+	Trickle      bool   // trickle layout instead of balanced layout
+	CarVersion   int    // CAR_VERSION_1, or CAR_VERSION_2 to append an index, 0 means CAR_VERSION_1
+}
+
+type CarInfo struct {
+	PayloadCid  string
+	CarFilePath string
+	CarFileSize int64
+	CarVersion  int
+	DataOffset  int64 // start of the carv1 data in the car file, 0 for carv1
+	DataSize    int64 // size of the carv1 data, equal to CarFileSize for carv1
+	BlockCount  int
+	SourceSize  int64 // total size of the source files
+}
+
+func GetDefaultCarOptions() *CarOptions {
+	carOptions := &CarOptions{
+		Chunker:      CHUNKER_DEFAULT,
+		RawLeaves:    true,
+		CidVersion:   1,
+		HashFunction: HASH_FUNCTION_DEFAULT,
+		CarVersion:   CAR_VERSION_1,
+	}
+
+	return carOptions
+}
+
+func (carOptions *CarOptions) getCidBuilder() (cid.Builder, error) {
+	hashFunction := carOptions.HashFunction
+	if hashFunction == "" {
+		hashFunction = HASH_FUNCTION_DEFAULT
+	}
+
+	hashCode, ok := multihash.Names[hashFunction]
+	if !ok {
+		err := fmt.Errorf("unknown hash function:%s", hashFunction)
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	if carOptions.CidVersion != 0 && carOptions.CidVersion != 1 {
+		err := fmt.Errorf("cid version should be 0 or 1, got:%d", carOptions.CidVersion)
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	if carOptions.CidVersion == 0 && (carOptions.RawLeaves || hashCode != multihash.SHA2_256) {
+		err := fmt.Errorf("cid version 0 supports neither raw leaves nor hash function other than %s", HASH_FUNCTION_DEFAULT)
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	prefix, err := merkledag.PrefixForCidVersion(carOptions.CidVersion)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	prefix.MhType = hashCode
+	prefix.MhLength = -1
+
+	return &prefix, nil
+}
+
+//builds the unixfs dag of srcPath, which is a file or a directory, and writes it to destCarFilePath
+func GenerateCarFile(ctx context.Context, srcPath, destCarFilePath string, carOptions *CarOptions) (*CarInfo, error) {
+	if carOptions == nil {
+		carOptions = GetDefaultCarOptions()
+	}
+
+	carVersion := carOptions.CarVersion
+	if carVersion == 0 {
+		carVersion = CAR_VERSION_1
+	}
+	if carVersion != CAR_VERSION_1 && carVersion != CAR_VERSION_2 {
+		err := fmt.Errorf("car version should be %d or %d, got:%d", CAR_VERSION_1, CAR_VERSION_2, carVersion)
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	cidBuilder, err := carOptions.getCidBuilder()
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	carWriter, err := createCarWriter(destCarFilePath, carVersion, cidBuilder)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	dagBuilder := &dagBuilder{
+		carOptions: carOptions,
+		cidBuilder: cidBuilder,
+		dagService: carWriter,
+	}
+
+	root, err := dagBuilder.addPath(ctx, srcPath)
+	if err == nil && root == nil {
+		err = fmt.Errorf("%s is neither a file nor a directory", srcPath)
+	}
+	if err != nil {
+		logs.GetLogger().Error(err)
+		carWriter.abort()
+		return nil, err
+	}
+
+	err = carWriter.finish(root.Cid())
+	if err != nil {
+		logs.GetLogger().Error(err)
+		carWriter.abort()
+		return nil, err
+	}
+
+	carInfo := &CarInfo{
+		PayloadCid:  root.Cid().String(),
+		CarFilePath: destCarFilePath,
+		CarFileSize: carWriter.fileSize,
+		CarVersion:  carVersion,
+		DataOffset:  carWriter.dataOffset,
+		DataSize:    carWriter.headerSize + carWriter.blocksSize,
+		BlockCount:  len(carWriter.cids),
+		SourceSize:  dagBuilder.sourceSize,
+	}
+
+	return carInfo, nil
+}
+
+//generates [destCarDir]/[name of srcPath].car, the piece cid is calculated from the carv1 data
+func GenerateCarFileDesc(ctx context.Context, srcPath, destCarDir string, carOptions *CarOptions) (*model.FileDesc, error) {
+	srcPath = filepath.Clean(srcPath)
+	carFileName := filepath.Base(srcPath) + CAR_FILE_EXTENSION
+	carFilePath := filepath.Join(destCarDir, carFileName)
+
+	carInfo, err := GenerateCarFile(ctx, srcPath, carFilePath, carOptions)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	carFile, err := os.Open(carFilePath)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+	defer carFile.Close()
+
+	pieceCommitment, err := commp.CalcCommP(io.NewSectionReader(carFile, carInfo.DataOffset, carInfo.DataSize))
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	fileDesc := &model.FileDesc{
+		SourceFileName: filepath.Base(srcPath),
+		SourceFilePath: srcPath,
+		SourceFileSize: carInfo.SourceSize,
+		CarFileName:    carFileName,
+		CarFilePath:    carFilePath,
+		CarFileSize:    carInfo.CarFileSize,
+		PayloadCid:     carInfo.PayloadCid,
+		PieceCid:       pieceCommitment.PieceCid,
+	}
+
+	return fileDesc, nil
+}
+
+type dagBuilder struct {
+	carOptions *CarOptions
+	cidBuilder cid.Builder
+	dagService ipld.DAGService
+	sourceSize int64
+}
+
+//returns nil node for paths which are neither regular files, directories nor symlinks
+func (dagBuilder *dagBuilder) addPath(ctx context.Context, path string) (ipld.Node, error) {
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	fileInfo, err := os.Lstat(path)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	switch mode := fileInfo.Mode(); {
+	case mode.IsRegular():
+		return dagBuilder.addFile(ctx, path)
+	case mode.IsDir():
+		return dagBuilder.addDir(ctx, path)
+	case mode&os.ModeSymlink != 0:
+		return dagBuilder.addSymlink(ctx, path)
+	default:
+		logs.GetLogger().Warn("skip ", path, ", it is neither a file nor a directory")
+		return nil, nil
+	}
+}
+
+func (dagBuilder *dagBuilder) addFile(ctx context.Context, path string) (ipld.Node, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+	defer file.Close()
+
+	chunkerSpec := dagBuilder.carOptions.Chunker
+	if chunkerSpec == "" {
+		chunkerSpec = CHUNKER_DEFAULT
+	}
+
+	reader := &contextReader{ctx: ctx, reader: file}
+	splitter, err := chunker.FromString(reader, chunkerSpec)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	maxLinks := dagBuilder.carOptions.MaxLinks
+	if maxLinks <= 0 {
+		maxLinks = helpers.DefaultLinksPerBlock
+	}
+
+	dagBuilderParams := helpers.DagBuilderParams{
+		Maxlinks:   maxLinks,
+		RawLeaves:  dagBuilder.carOptions.RawLeaves,
+		CidBuilder: dagBuilder.cidBuilder,
+		Dagserv:    dagBuilder.dagService,
+	}
+
+	dagBuilderHelper, err := dagBuilderParams.New(splitter)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	var node ipld.Node
+	if dagBuilder.carOptions.Trickle {
+		node, err = trickle.Layout(dagBuilderHelper)
+	} else {
+		node, err = balanced.Layout(dagBuilderHelper)
+	}
+	if err != nil {
+		logs.GetLogger().Error(path, ":", err)
+		return nil, err
+	}
+
+	dagBuilder.sourceSize += reader.size
+	return node, nil
+}
+
+func (dagBuilder *dagBuilder) addDir(ctx context.Context, path string) (ipld.Node, error) {
+	fileInfos, err := ioutil.ReadDir(path)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	directory := uio.NewDirectory(dagBuilder.dagService)
+	directory.SetCidBuilder(dagBuilder.cidBuilder)
+	for _, fileInfo := range fileInfos {
+		child, err := dagBuilder.addPath(ctx, filepath.Join(path, fileInfo.Name()))
+		if err != nil {
+			logs.GetLogger().Error(err)
+			return nil, err
+		}
+
+		if child == nil {
+			continue
+		}
+
+		err = directory.AddChild(ctx, fileInfo.Name(), child)
+		if err != nil {
+			logs.GetLogger().Error(err)
+			return nil, err
+		}
+	}
+
+	node, err := directory.GetNode()
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	err = dagBuilder.dagService.Add(ctx, node)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	return node, nil
+}
+
+func (dagBuilder *dagBuilder) addSymlink(ctx context.Context, path string) (ipld.Node, error) {
+	target, err := os.Readlink(path)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	data, err := unixfs.SymlinkData(target)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	node := merkledag.NodeWithData(data)
+	node.SetCidBuilder(dagBuilder.cidBuilder)
+
+	err = dagBuilder.dagService.Add(ctx, node)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	return node, nil
+}
+
+//stops reading when ctx is done and counts the bytes read
+type contextReader struct {
+	ctx    context.Context
+	reader io.Reader
+	size   int64
+}
+
+func (contextReader *contextReader) Read(p []byte) (int, error) {
+	if contextReader.ctx.Err() != nil {
+		return 0, contextReader.ctx.Err()
+	}
+
+	n, err := contextReader.reader.Read(p)
+	contextReader.size += int64(n)
+	return n, err
+}
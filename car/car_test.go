@@ -0,0 +1,299 @@
+package car
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ipfs/go-blockservice"
+	"github.com/ipfs/go-cid"
+	offline "github.com/ipfs/go-ipfs-exchange-offline"
+	ipld "github.com/ipfs/go-ipld-format"
+	"github.com/ipfs/go-merkledag"
+	"github.com/ipfs/go-unixfs"
+	uio "github.com/ipfs/go-unixfs/io"
+	carv2 "github.com/ipld/go-car/v2"
+	"github.com/ipld/go-car/v2/blockstore"
+	"github.com/ipld/go-car/v2/index"
+)
+
+//creates a directory with small, large, empty, duplicated and nested files and a symlink
+func createTestSource(t *testing.T) string {
+	srcDir := filepath.Join(t.TempDir(), "source")
+	large := make([]byte, 3*1024*1024+100)
+	for i := range large {
+		large[i] = byte(i * 7)
+	}
+
+	files := map[string][]byte{
+		"small.txt":       []byte("hello car"),
+		"copy.txt":        []byte("hello car"),
+		"large.bin":       large,
+		"empty":           {},
+		"dir/nested.txt":  []byte("nested"),
+		"dir/sub/deep.md": []byte("# deep"),
+	}
+	for name, content := range files {
+		path := filepath.Join(srcDir, name)
+		err := os.MkdirAll(filepath.Dir(path), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = ioutil.WriteFile(path, content, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err := os.Symlink("small.txt", filepath.Join(srcDir, "link"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return srcDir
+}
+
+func TestGenerateCarFileRoundTrip(t *testing.T) {
+	srcDir := createTestSource(t)
+
+	tests := []struct {
+		name       string
+		carOptions *CarOptions
+		carVersion uint64
+	}{
+		{"default options", nil, 1},
+		{"carv2", &CarOptions{RawLeaves: true, CidVersion: 1, CarVersion: CAR_VERSION_2}, 2},
+		{"cid version 0", &CarOptions{CidVersion: 0}, 1},
+		{"cid version 0 carv2", &CarOptions{CidVersion: 0, CarVersion: CAR_VERSION_2}, 2},
+		{"trickle with small chunks", &CarOptions{Chunker: "size-262144", RawLeaves: true, CidVersion: 1, MaxLinks: 4, Trickle: true, CarVersion: CAR_VERSION_2}, 2},
+		{"balanced with small chunks", &CarOptions{Chunker: "size-262144", CidVersion: 1, MaxLinks: 4}, 1},
+		{"blake2b", &CarOptions{RawLeaves: true, CidVersion: 1, HashFunction: "blake2b-256", CarVersion: CAR_VERSION_2}, 2},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := context.Background()
+			carFilePath := filepath.Join(t.TempDir(), "source.car")
+			carInfo, err := GenerateCarFile(ctx, srcDir, carFilePath, test.carOptions)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			reader, err := carv2.OpenReader(carFilePath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer reader.Close()
+
+			if reader.Version != test.carVersion || carInfo.CarVersion != int(test.carVersion) {
+				t.Errorf("version = %d, car info version = %d, want %d", reader.Version, carInfo.CarVersion, test.carVersion)
+			}
+
+			roots, err := reader.Roots()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(roots) != 1 || roots[0].String() != carInfo.PayloadCid {
+				t.Errorf("roots = %v, want %s", roots, carInfo.PayloadCid)
+			}
+
+			fileInfo, err := os.Stat(carFilePath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if fileInfo.Size() != carInfo.CarFileSize {
+				t.Errorf("car file size = %d, want %d", carInfo.CarFileSize, fileInfo.Size())
+			}
+
+			if test.carVersion == 2 {
+				checkCarV2Layout(t, reader, carInfo)
+			} else if carInfo.DataOffset != 0 || carInfo.DataSize != carInfo.CarFileSize {
+				t.Errorf("data offset = %d, data size = %d, want 0 and %d", carInfo.DataOffset, carInfo.DataSize, carInfo.CarFileSize)
+			}
+
+			checkCarBlocks(t, reader, carInfo)
+
+			blockstore, err := blockstore.OpenReadOnly(carFilePath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer blockstore.Close()
+
+			dagService := merkledag.NewDAGService(blockservice.New(blockstore, offline.Exchange(blockstore)))
+			root, err := dagService.Get(ctx, roots[0])
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkDagContent(t, ctx, dagService, root, srcDir)
+		})
+	}
+}
+
+//the header matches the car info and the index matches the one generated by go-car
+func checkCarV2Layout(t *testing.T, reader *carv2.Reader, carInfo *CarInfo) {
+	if int64(reader.Header.DataOffset) != carInfo.DataOffset || int64(reader.Header.DataSize) != carInfo.DataSize {
+		t.Errorf("header data offset = %d, data size = %d, want %d and %d", reader.Header.DataOffset, reader.Header.DataSize, carInfo.DataOffset, carInfo.DataSize)
+	}
+
+	if reader.Header.IndexOffset != reader.Header.DataOffset+reader.Header.DataSize {
+		t.Errorf("index offset = %d, want %d", reader.Header.IndexOffset, reader.Header.DataOffset+reader.Header.DataSize)
+	}
+
+	carIndex, err := index.ReadFrom(reader.IndexReader())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	generatedIndex, err := carv2.GenerateIndex(reader.DataReader())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	blockReader, err := carv2.NewBlockReader(reader.DataReader())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for {
+		block, err := blockReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		offset, err := index.GetFirst(carIndex, block.Cid())
+		if err != nil {
+			t.Errorf("%s: %v", block.Cid(), err)
+			continue
+		}
+
+		generatedOffset, err := index.GetFirst(generatedIndex, block.Cid())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if offset != generatedOffset {
+			t.Errorf("%s: index offset = %d, want %d", block.Cid(), offset, generatedOffset)
+		}
+	}
+}
+
+//every block is hashed to its cid and appears once
+func checkCarBlocks(t *testing.T, reader *carv2.Reader, carInfo *CarInfo) {
+	blockReader, err := carv2.NewBlockReader(reader.DataReader())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	blockCids := map[cid.Cid]bool{}
+	for {
+		block, err := blockReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		blockCid, err := block.Cid().Prefix().Sum(block.RawData())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !blockCid.Equals(block.Cid()) {
+			t.Errorf("block %s is hashed to %s", block.Cid(), blockCid)
+		}
+
+		if blockCids[block.Cid()] {
+			t.Errorf("block %s is written more than once", block.Cid())
+		}
+		blockCids[block.Cid()] = true
+	}
+
+	if len(blockCids) != carInfo.BlockCount {
+		t.Errorf("blocks = %d, want %d", len(blockCids), carInfo.BlockCount)
+	}
+}
+
+//the unixfs dag of node has the same files, directories and symlinks as path
+func checkDagContent(t *testing.T, ctx context.Context, dagService ipld.DAGService, node ipld.Node, path string) {
+	fileInfo, err := os.Lstat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	switch mode := fileInfo.Mode(); {
+	case mode.IsRegular():
+		dagReader, err := uio.NewDagReader(ctx, node, dagService)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		content, err := ioutil.ReadAll(dagReader)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		source, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(content, source) {
+			t.Errorf("%s: content of %d bytes differs from the source of %d bytes", path, len(content), len(source))
+		}
+	case mode.IsDir():
+		directory, err := uio.NewDirectoryFromNode(dagService, node)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		links, err := directory.Links(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		fileInfos, err := ioutil.ReadDir(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(links) != len(fileInfos) {
+			t.Errorf("%s: %d links, want %d", path, len(links), len(fileInfos))
+		}
+
+		for _, link := range links {
+			child, err := link.GetNode(ctx, dagService)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			checkDagContent(t, ctx, dagService, child, filepath.Join(path, link.Name))
+		}
+	case mode&os.ModeSymlink != 0:
+		target, err := os.Readlink(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		protoNode, ok := node.(*merkledag.ProtoNode)
+		if !ok {
+			t.Fatalf("%s: symlink node is %T", path, node)
+		}
+
+		fsNode, err := unixfs.FSNodeFromBytes(protoNode.Data())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if fsNode.Type() != unixfs.TSymlink || string(fsNode.Data()) != target {
+			t.Errorf("%s: symlink to %q, want %q", path, fsNode.Data(), target)
+		}
+	}
+}
@@ -0,0 +1,422 @@
+package car
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/filswan/go-swan-lib/logs"
+	"github.com/filswan/go-swan-lib/model"
+
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+	cbor "github.com/ipfs/go-ipld-cbor"
+	"github.com/ipfs/go-merkledag"
+)
+
+const (
+	CAR_MAX_HEADER_SIZE  = 1024 * 1024
+	CAR_MAX_SECTION_SIZE = 32 * 1024 * 1024 // far above the largest block a chunker builds
+	CAR_READ_BUFFER_SIZE = 1024 * 1024
+)
+
+var (
+	ErrInvalidCarHeader  = errors.New("invalid car header")
+	ErrInvalidCarSection = errors.New("invalid car section")
+	ErrBlockHashMismatch = errors.New("block hash mismatch")
+	ErrRootMismatch      = errors.New("car root mismatch")
+	ErrCarSizeMismatch   = errors.New("car file size mismatch")
+	ErrCarBlockMissing   = errors.New("car block missing")
+)
+
+type CarBlock struct {
+	Cid    cid.Cid
+	Offset int64 // offset of the section from the start of the carv1 data
+	Data   []byte
+}
+
+type CarFileStat struct {
+	CarFilePath string
+	CarVersion  int
+	Roots       []string
+	CarFileSize int64
+	DataOffset  int64 // start of the carv1 data in the car file, 0 for carv1
+	DataSize    int64
+	IndexOffset int64 // 0 when the car file has no index
+	BlockCount  int
+	BlocksSize  int64    // total size of the block data
+	MissingCids []string // roots and blocks linked by the blocks of the car file, which are not in it
+}
+
+//reads the blocks of a carv1 or carv2 file in order
+type CarReader struct {
+	CarVersion  int
+	Roots       []cid.Cid
+	DataOffset  int64
+	DataSize    int64
+	IndexOffset int64
+
+	file     *os.File
+	reader   *bufio.Reader
+	position int64 // offset from the start of the carv1 data
+}
+
+func OpenCarReader(carFilePath string) (*CarReader, error) {
+	file, err := os.Open(carFilePath)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	carReader, err := getCarReader(file)
+	if err != nil {
+		logs.GetLogger().Error(carFilePath, ":", err)
+		file.Close()
+		return nil, err
+	}
+
+	return carReader, nil
+}
+
+func getCarReader(file *os.File) (*CarReader, error) {
+	fileInfo, err := file.Stat()
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	carReader := &CarReader{
+		file:     file,
+		DataSize: fileInfo.Size(),
+	}
+
+	reader := bufio.NewReaderSize(io.NewSectionReader(file, 0, fileInfo.Size()), CAR_READ_BUFFER_SIZE)
+	carHeader, headerSize, err := readCarHeader(reader)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	switch carHeader.Version {
+	case CAR_VERSION_1:
+		carReader.CarVersion = CAR_VERSION_1
+		carReader.Roots = carHeader.Roots
+		carReader.reader = reader
+		carReader.position = headerSize
+	case CAR_VERSION_2:
+		carReader.CarVersion = CAR_VERSION_2
+		err = carReader.readCarV2Header(reader, fileInfo.Size())
+		if err != nil {
+			logs.GetLogger().Error(err)
+			return nil, err
+		}
+	default:
+		err := fmt.Errorf("unsupported car version:%d, %w", carHeader.Version, ErrInvalidCarHeader)
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	if len(carReader.Roots) == 0 {
+		err := fmt.Errorf("no root, %w", ErrInvalidCarHeader)
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	return carReader, nil
+}
+
+//the reader is positioned after the pragma, the carv1 header inside the data is read as well
+func (carReader *CarReader) readCarV2Header(reader *bufio.Reader, fileSize int64) error {
+	header := make([]byte, CARV2_HEADER_SIZE)
+	_, err := io.ReadFull(reader, header)
+	if err != nil {
+		err := fmt.Errorf("read carv2 header, %s, %w", err.Error(), ErrInvalidCarHeader)
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	headerFields := header[CARV2_CHARACTERISTICS_SIZE:]
+	carReader.DataOffset = int64(binary.LittleEndian.Uint64(headerFields[0:]))
+	carReader.DataSize = int64(binary.LittleEndian.Uint64(headerFields[8:]))
+	carReader.IndexOffset = int64(binary.LittleEndian.Uint64(headerFields[16:]))
+
+	if carReader.DataOffset < CARV2_PRAGMA_SIZE+CARV2_HEADER_SIZE || carReader.DataSize <= 0 || carReader.DataOffset+carReader.DataSize > fileSize {
+		err := fmt.Errorf("data offset:%d, data size:%d, file size:%d, %w", carReader.DataOffset, carReader.DataSize, fileSize, ErrInvalidCarHeader)
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	if carReader.IndexOffset != 0 && (carReader.IndexOffset < carReader.DataOffset+carReader.DataSize || carReader.IndexOffset > fileSize) {
+		err := fmt.Errorf("index offset:%d, file size:%d, %w", carReader.IndexOffset, fileSize, ErrInvalidCarHeader)
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	carReader.reader = bufio.NewReaderSize(io.NewSectionReader(carReader.file, carReader.DataOffset, carReader.DataSize), CAR_READ_BUFFER_SIZE)
+	carHeader, headerSize, err := readCarHeader(carReader.reader)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	if carHeader.Version != CAR_VERSION_1 {
+		err := fmt.Errorf("carv2 data should be carv1, got version:%d, %w", carHeader.Version, ErrInvalidCarHeader)
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	carReader.Roots = carHeader.Roots
+	carReader.position = headerSize
+
+	return nil
+}
+
+//returns the header and its size including the length prefix
+func readCarHeader(reader *bufio.Reader) (*CarHeader, int64, error) {
+	headerBytes, prefixSize, err := readSection(reader, CAR_MAX_HEADER_SIZE)
+	if err != nil {
+		err := fmt.Errorf("%s, %w", err.Error(), ErrInvalidCarHeader)
+		logs.GetLogger().Error(err)
+		return nil, 0, err
+	}
+
+	carHeader := &CarHeader{}
+	err = cbor.DecodeInto(headerBytes, carHeader)
+	if err != nil {
+		err := fmt.Errorf("%s, %w", err.Error(), ErrInvalidCarHeader)
+		logs.GetLogger().Error(err)
+		return nil, 0, err
+	}
+
+	return carHeader, int64(prefixSize + len(headerBytes)), nil
+}
+
+//reads a varint length prefixed section, io.EOF means no more sections
+func readSection(reader *bufio.Reader, maxSize uint64) ([]byte, int, error) {
+	if _, err := reader.Peek(1); err == io.EOF {
+		return nil, 0, io.EOF
+	}
+
+	length, err := binary.ReadUvarint(reader)
+	if err != nil {
+		return nil, 0, fmt.Errorf("read section length, %s", err.Error())
+	}
+
+	if length == 0 || length > maxSize {
+		return nil, 0, fmt.Errorf("section length:%d should be between 1 and %d", length, maxSize)
+	}
+
+	section := make([]byte, length)
+	_, err = io.ReadFull(reader, section)
+	if err != nil {
+		return nil, 0, fmt.Errorf("read section of %d bytes, %s", length, err.Error())
+	}
+
+	var lengthPrefix [binary.MaxVarintLen64]byte
+	return section, binary.PutUvarint(lengthPrefix[:], length), nil
+}
+
+//returns io.EOF after the last block, the hash of the block is verified
+func (carReader *CarReader) Next() (*CarBlock, error) {
+	section, prefixSize, err := readSection(carReader.reader, CAR_MAX_SECTION_SIZE)
+	if err == io.EOF {
+		return nil, io.EOF
+	}
+	if err != nil {
+		err := fmt.Errorf("offset:%d, %s, %w", carReader.position, err.Error(), ErrInvalidCarSection)
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	cidSize, c, err := cid.CidFromBytes(section)
+	if err != nil {
+		err := fmt.Errorf("offset:%d, %s, %w", carReader.position, err.Error(), ErrInvalidCarSection)
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	carBlock := &CarBlock{
+		Cid:    c,
+		Offset: carReader.position,
+		Data:   section[cidSize:],
+	}
+	carReader.position += int64(prefixSize + len(section))
+
+	hashCid, err := c.Prefix().Sum(carBlock.Data)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	if !bytes.Equal(hashCid.Hash(), c.Hash()) {
+		err := fmt.Errorf("cid:%s, offset:%d, %w", c, carBlock.Offset, ErrBlockHashMismatch)
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	return carBlock, nil
+}
+
+func (carReader *CarReader) Close() error {
+	return carReader.file.Close()
+}
+
+//reads and verifies all the blocks
+func InspectCarFile(carFilePath string) (*CarFileStat, error) {
+	carReader, err := OpenCarReader(carFilePath)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+	defer carReader.Close()
+
+	fileInfo, err := carReader.file.Stat()
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	carFileStat := &CarFileStat{
+		CarFilePath: carFilePath,
+		CarVersion:  carReader.CarVersion,
+		CarFileSize: fileInfo.Size(),
+		DataOffset:  carReader.DataOffset,
+		DataSize:    carReader.DataSize,
+		IndexOffset: carReader.IndexOffset,
+	}
+
+	for _, root := range carReader.Roots {
+		carFileStat.Roots = append(carFileStat.Roots, root.String())
+	}
+
+	//blocks are keyed by multihash, so that a cidv0 link matches a cidv1 block
+	presentBlocks := map[string]bool{}
+	linkedBlocks := map[string]cid.Cid{}
+	for _, root := range carReader.Roots {
+		linkedBlocks[string(root.Hash())] = root
+	}
+
+	for {
+		carBlock, err := carReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			logs.GetLogger().Error(carFilePath, ":", err)
+			return nil, err
+		}
+
+		carFileStat.BlockCount++
+		carFileStat.BlocksSize += int64(len(carBlock.Data))
+		presentBlocks[string(carBlock.Cid.Hash())] = true
+
+		links, err := getBlockLinks(carBlock)
+		if err != nil {
+			logs.GetLogger().Error(carFilePath, ":", err)
+			return nil, err
+		}
+
+		for _, link := range links {
+			linkedBlocks[string(link.Hash())] = link
+		}
+	}
+
+	for key, linkedCid := range linkedBlocks {
+		if !presentBlocks[key] {
+			carFileStat.MissingCids = append(carFileStat.MissingCids, linkedCid.String())
+		}
+	}
+	sort.Strings(carFileStat.MissingCids)
+
+	return carFileStat, nil
+}
+
+//links of dag-pb and dag-cbor blocks, blocks of other codecs have none
+func getBlockLinks(carBlock *CarBlock) ([]cid.Cid, error) {
+	var links []cid.Cid
+	switch carBlock.Cid.Type() {
+	case cid.DagProtobuf:
+		node, err := merkledag.DecodeProtobuf(carBlock.Data)
+		if err != nil {
+			err := fmt.Errorf("cid:%s, offset:%d, %s, %w", carBlock.Cid, carBlock.Offset, err.Error(), ErrInvalidCarSection)
+			logs.GetLogger().Error(err)
+			return nil, err
+		}
+
+		for _, link := range node.Links() {
+			links = append(links, link.Cid)
+		}
+	case cid.DagCBOR:
+		block, err := blocks.NewBlockWithCid(carBlock.Data, carBlock.Cid)
+		if err != nil {
+			logs.GetLogger().Error(err)
+			return nil, err
+		}
+
+		node, err := cbor.DecodeBlock(block)
+		if err != nil {
+			err := fmt.Errorf("cid:%s, offset:%d, %s, %w", carBlock.Cid, carBlock.Offset, err.Error(), ErrInvalidCarSection)
+			logs.GetLogger().Error(err)
+			return nil, err
+		}
+
+		for _, link := range node.Links() {
+			links = append(links, link.Cid)
+		}
+	}
+
+	return links, nil
+}
+
+//inspects the car file and checks that its only root is payloadCid, and that the whole dag of the root is in it,
+//so that a truncated car file with a valid header is rejected
+func VerifyCarFile(carFilePath, payloadCid string) (*CarFileStat, error) {
+	expectedRoot, err := cid.Decode(payloadCid)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	carFileStat, err := InspectCarFile(carFilePath)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	if len(carFileStat.Roots) != 1 || carFileStat.Roots[0] != expectedRoot.String() {
+		err := fmt.Errorf("car file:%s, roots:%v, expected:%s, %w", carFilePath, carFileStat.Roots, payloadCid, ErrRootMismatch)
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	if len(carFileStat.MissingCids) > 0 {
+		err := fmt.Errorf("car file:%s, %d blocks missing, first:%s, %w", carFilePath, len(carFileStat.MissingCids), carFileStat.MissingCids[0], ErrCarBlockMissing)
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	return carFileStat, nil
+}
+
+//verifies the downloaded car file of an offline deal before it is imported,
+//its size is checked as well when the deal has the car file size
+func VerifyOfflineDealCarFile(offlineDeal *model.OfflineDeal) (*CarFileStat, error) {
+	carFileStat, err := VerifyCarFile(offlineDeal.FilePath, offlineDeal.PayloadCid)
+	if err != nil {
+		logs.GetLogger().Error("deal cid:", offlineDeal.DealCid, ", ", err)
+		return nil, err
+	}
+
+	if offlineDeal.CarFileSize > 0 && carFileStat.CarFileSize != offlineDeal.CarFileSize {
+		err := fmt.Errorf("deal cid:%s, car file size:%d, expected:%d, %w", offlineDeal.DealCid, carFileStat.CarFileSize, offlineDeal.CarFileSize, ErrCarSizeMismatch)
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	return carFileStat, nil
+}
@@ -0,0 +1,145 @@
+package car
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestInspectCarFile(t *testing.T) {
+	srcDir := createTestSource(t)
+
+	tests := []struct {
+		name       string
+		carOptions *CarOptions
+	}{
+		{"carv1", &CarOptions{RawLeaves: true, CidVersion: 1, CarVersion: CAR_VERSION_1}},
+		{"carv2", &CarOptions{RawLeaves: true, CidVersion: 1, CarVersion: CAR_VERSION_2}},
+		{"cid version 0", &CarOptions{CidVersion: 0, Chunker: "size-262144", MaxLinks: 4}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			carFilePath := filepath.Join(t.TempDir(), "source.car")
+			carInfo, err := GenerateCarFile(context.Background(), srcDir, carFilePath, test.carOptions)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			carFileStat, err := VerifyCarFile(carFilePath, carInfo.PayloadCid)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if carFileStat.CarVersion != carInfo.CarVersion ||
+				carFileStat.CarFileSize != carInfo.CarFileSize ||
+				carFileStat.DataOffset != carInfo.DataOffset ||
+				carFileStat.DataSize != carInfo.DataSize ||
+				carFileStat.BlockCount != carInfo.BlockCount {
+				t.Errorf("car file stat = %+v, want the values of car info %+v", carFileStat, carInfo)
+			}
+
+			hasIndex := carFileStat.IndexOffset > 0
+			if hasIndex != (carInfo.CarVersion == CAR_VERSION_2) {
+				t.Errorf("index offset = %d with car version %d", carFileStat.IndexOffset, carInfo.CarVersion)
+			}
+
+			if len(carFileStat.MissingCids) > 0 {
+				t.Errorf("missing cids = %v, want none", carFileStat.MissingCids)
+			}
+		})
+	}
+}
+
+type carSection struct {
+	offset int64
+	size   int64
+}
+
+//sections of the blocks of a carv1 file and the size of its header
+func getCarSections(t *testing.T, carFilePath string) (int64, []carSection) {
+	carReader, err := OpenCarReader(carFilePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer carReader.Close()
+
+	var sections []carSection
+	for {
+		carBlock, err := carReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(sections) > 0 {
+			sections[len(sections)-1].size = carBlock.Offset - sections[len(sections)-1].offset
+		}
+		sections = append(sections, carSection{offset: carBlock.Offset})
+	}
+
+	sections[len(sections)-1].size = carReader.DataSize - sections[len(sections)-1].offset
+	return sections[0].offset, sections
+}
+
+func TestVerifyCarFileRejects(t *testing.T) {
+	srcDir := createTestSource(t)
+	carFilePath := filepath.Join(t.TempDir(), "source.car")
+	carOptions := &CarOptions{Chunker: "size-262144", RawLeaves: true, CidVersion: 1, MaxLinks: 4}
+	carInfo, err := GenerateCarFile(context.Background(), srcDir, carFilePath, carOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	carData, err := ioutil.ReadFile(carFilePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	headerSize, sections := getCarSections(t, carFilePath)
+	lastSection := sections[len(sections)-1]
+
+	type carCase struct {
+		name       string
+		data       []byte
+		payloadCid string
+		err        error
+	}
+
+	tests := []carCase{
+		{"other payload cid", carData, "bafkqaaa", ErrRootMismatch},
+		{"header only", carData[:headerSize], carInfo.PayloadCid, ErrCarBlockMissing},
+		{"truncated in a section", carData[:lastSection.offset+lastSection.size/2], carInfo.PayloadCid, ErrInvalidCarSection},
+		{"block data changed", append(append([]byte{}, carData[:len(carData)-1]...), carData[len(carData)-1]^0xff), carInfo.PayloadCid, ErrBlockHashMismatch},
+	}
+
+	//dropping any block, or all the blocks from it to the end, leaves a dag with a missing block
+	for i, section := range sections {
+		truncated := carData[:section.offset]
+		tests = append(tests, carCase{fmt.Sprintf("truncated before block %d", i), truncated, carInfo.PayloadCid, ErrCarBlockMissing})
+
+		dropped := append(append([]byte{}, carData[:section.offset]...), carData[section.offset+section.size:]...)
+		tests = append(tests, carCase{fmt.Sprintf("block %d dropped", i), dropped, carInfo.PayloadCid, ErrCarBlockMissing})
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			testCarFilePath := filepath.Join(t.TempDir(), "test.car")
+			err := ioutil.WriteFile(testCarFilePath, test.data, 0644)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = VerifyCarFile(testCarFilePath, test.payloadCid)
+			if !errors.Is(err, test.err) {
+				t.Errorf("error = %v, want %v", err, test.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,382 @@
+package car
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/filswan/go-swan-lib/logs"
+	"github.com/filswan/go-swan-lib/model"
+)
+
+const (
+	SPLIT_SECTOR_SIZE_DEFAULT      = 32 * 1024 * 1024 * 1024
+	SPLIT_HEADROOM_PERCENT_DEFAULT = 10 // kept for the car overhead, the blocks of the dag and the car sections
+	SPLIT_CHUNK_NAME_FORMAT        = "%s.part%04d"
+	SPLIT_GROUP_NAME_FORMAT        = "%s-%04d"
+)
+
+var ErrNothingToSplit = errors.New("nothing to split")
+
+type SplitOptions struct {
+	SectorSize      int64  // padded piece size a car file of a group must fit, a power of 2
+	HeadroomPercent int    // of the unpadded piece size not filled by the source files
+	GroupNamePrefix string // name of the source directory when empty
+}
+
+//a whole source file, or a part of a file larger than a group
+type SplitChunk struct {
+	SourceFilePath string
+	RelPath        string // path of the file inside the group, relative to the source directory
+	Offset         int64
+	Size           int64
+	PartIndex      int  // 0 for a whole file
+	IsPart         bool // stored in the group as RelPath.partNNNN, see SPLIT_CHUNK_NAME_FORMAT
+}
+
+type SplitGroup struct {
+	Index  int
+	Name   string
+	Size   int64 // total size of the chunks
+	Chunks []*SplitChunk
+}
+
+func GetDefaultSplitOptions() *SplitOptions {
+	splitOptions := &SplitOptions{
+		SectorSize:      SPLIT_SECTOR_SIZE_DEFAULT,
+		HeadroomPercent: SPLIT_HEADROOM_PERCENT_DEFAULT,
+	}
+
+	return splitOptions
+}
+
+//the largest total size of the source files of a group
+func GetSplitGroupMaxSize(splitOptions *SplitOptions) int64 {
+	unpaddedPieceSize := splitOptions.SectorSize / 128 * 127
+	return unpaddedPieceSize * int64(100-splitOptions.HeadroomPercent) / 100
+}
+
+//returns the path of a chunk inside its group
+func (splitChunk *SplitChunk) GetGroupPath() string {
+	if !splitChunk.IsPart {
+		return splitChunk.RelPath
+	}
+
+	return fmt.Sprintf(SPLIT_CHUNK_NAME_FORMAT, splitChunk.RelPath, splitChunk.PartIndex)
+}
+
+//walks srcPath and packs its files into groups whose size is at most GetSplitGroupMaxSize,
+//files larger than that are split into parts, the parts filling a whole group get a group each,
+//the groups are filled largest file first, a file goes to the first group with room for it,
+//nil splitOptions means GetDefaultSplitOptions()
+func PlanSplit(srcPath string, splitOptions *SplitOptions) ([]*SplitGroup, error) {
+	if splitOptions == nil {
+		splitOptions = GetDefaultSplitOptions()
+	}
+
+	sectorSize := splitOptions.SectorSize
+	if sectorSize <= 0 || sectorSize&(sectorSize-1) != 0 {
+		err := fmt.Errorf("sector size:%d, it should be a power of 2", sectorSize)
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	maxGroupSize := GetSplitGroupMaxSize(splitOptions)
+	if splitOptions.HeadroomPercent < 0 || splitOptions.HeadroomPercent >= 100 || maxGroupSize <= 0 {
+		err := fmt.Errorf("invalid sector size:%d or headroom percent:%d", splitOptions.SectorSize, splitOptions.HeadroomPercent)
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	srcPath = filepath.Clean(srcPath)
+	chunks, err := getSplitChunks(srcPath, maxGroupSize)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	if len(chunks) == 0 {
+		err := fmt.Errorf("%s, %w", srcPath, ErrNothingToSplit)
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	sort.SliceStable(chunks, func(i, j int) bool {
+		return chunks[i].Size > chunks[j].Size
+	})
+
+	groupNamePrefix := splitOptions.GroupNamePrefix
+	if groupNamePrefix == "" {
+		groupNamePrefix = filepath.Base(srcPath)
+	}
+
+	groups := []*SplitGroup{}
+	for _, chunk := range chunks {
+		var group *SplitGroup
+		for _, splitGroup := range groups {
+			if splitGroup.Size+chunk.Size <= maxGroupSize {
+				group = splitGroup
+				break
+			}
+		}
+
+		if group == nil {
+			group = &SplitGroup{
+				Index: len(groups),
+				Name:  fmt.Sprintf(SPLIT_GROUP_NAME_FORMAT, groupNamePrefix, len(groups)),
+			}
+			groups = append(groups, group)
+		}
+
+		group.Chunks = append(group.Chunks, chunk)
+		group.Size += chunk.Size
+	}
+
+	for _, group := range groups {
+		sort.SliceStable(group.Chunks, func(i, j int) bool {
+			return group.Chunks[i].GetGroupPath() < group.Chunks[j].GetGroupPath()
+		})
+	}
+
+	return groups, nil
+}
+
+//the regular files under srcPath in lexical order, or srcPath itself, split into parts of at most maxChunkSize
+func getSplitChunks(srcPath string, maxChunkSize int64) ([]*SplitChunk, error) {
+	fileInfo, err := os.Stat(srcPath)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	rootDir := srcPath
+	if !fileInfo.IsDir() {
+		rootDir = filepath.Dir(srcPath)
+	}
+
+	chunks := []*SplitChunk{}
+	err = filepath.Walk(srcPath, func(walkPath string, fileInfo os.FileInfo, err error) error {
+		if err != nil {
+			logs.GetLogger().Error(err)
+			return err
+		}
+
+		if fileInfo.IsDir() {
+			return nil
+		}
+
+		if !fileInfo.Mode().IsRegular() {
+			logs.GetLogger().Warn("skip ", walkPath, ", it is not a regular file")
+			return nil
+		}
+
+		relPath, err := filepath.Rel(rootDir, walkPath)
+		if err != nil {
+			logs.GetLogger().Error(err)
+			return err
+		}
+
+		if fileInfo.Size() <= maxChunkSize {
+			chunks = append(chunks, &SplitChunk{
+				SourceFilePath: walkPath,
+				RelPath:        relPath,
+				Size:           fileInfo.Size(),
+			})
+			return nil
+		}
+
+		for offset := int64(0); offset < fileInfo.Size(); offset += maxChunkSize {
+			size := fileInfo.Size() - offset
+			if size > maxChunkSize {
+				size = maxChunkSize
+			}
+
+			chunks = append(chunks, &SplitChunk{
+				SourceFilePath: walkPath,
+				RelPath:        relPath,
+				Offset:         offset,
+				Size:           size,
+				PartIndex:      int(offset / maxChunkSize),
+				IsPart:         true,
+			})
+		}
+
+		return nil
+	})
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	return chunks, nil
+}
+
+//creates [destDir]/[group name] with the chunks of the group at their group paths,
+//whole files are hard linked when possible and copied otherwise, parts are copied
+func MaterializeSplitGroup(splitGroup *SplitGroup, destDir string) (string, error) {
+	groupDir, err := filepath.Abs(filepath.Join(destDir, splitGroup.Name))
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return "", err
+	}
+
+	err = os.MkdirAll(groupDir, os.ModePerm)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return "", err
+	}
+
+	for _, chunk := range splitGroup.Chunks {
+		destFilePath := filepath.Join(groupDir, chunk.GetGroupPath())
+		sourceFilePath, err := filepath.Abs(chunk.SourceFilePath)
+		if err != nil {
+			logs.GetLogger().Error(err)
+			return "", err
+		}
+
+		if sourceFilePath == destFilePath {
+			err := fmt.Errorf("%s is both a source file and a file of group:%s", destFilePath, splitGroup.Name)
+			logs.GetLogger().Error(err)
+			return "", err
+		}
+
+		err = os.MkdirAll(filepath.Dir(destFilePath), os.ModePerm)
+		if err != nil {
+			logs.GetLogger().Error(err)
+			return "", err
+		}
+
+		os.Remove(destFilePath)
+		if !chunk.IsPart && os.Link(chunk.SourceFilePath, destFilePath) == nil {
+			continue
+		}
+
+		err = copyChunk(chunk, destFilePath)
+		if err != nil {
+			logs.GetLogger().Error(err)
+			return "", err
+		}
+	}
+
+	return groupDir, nil
+}
+
+func copyChunk(chunk *SplitChunk, destFilePath string) error {
+	srcFile, err := os.Open(chunk.SourceFilePath)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+	defer srcFile.Close()
+
+	destFile, err := os.Create(destFilePath)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	written, err := io.Copy(destFile, io.NewSectionReader(srcFile, chunk.Offset, chunk.Size))
+	if err == nil && written != chunk.Size {
+		err = fmt.Errorf("%s, copied:%d, expected:%d, the source file changed", chunk.SourceFilePath, written, chunk.Size)
+	}
+	if err != nil {
+		logs.GetLogger().Error(err)
+		destFile.Close()
+		return err
+	}
+
+	err = destFile.Close()
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	return nil
+}
+
+//plans the split of srcPath and materializes the groups under destDir, which should not be inside srcPath,
+//the file descs have the source file name, path and size of each group, and the name of its car file
+func SplitDataset(srcPath, destDir string, splitOptions *SplitOptions) ([]*SplitGroup, []*model.FileDesc, error) {
+	insideSrcPath, err := isPathInside(destDir, srcPath)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, nil, err
+	}
+
+	if insideSrcPath {
+		err := fmt.Errorf("dest dir:%s should not be inside the source:%s", destDir, srcPath)
+		logs.GetLogger().Error(err)
+		return nil, nil, err
+	}
+
+	groups, err := PlanSplit(srcPath, splitOptions)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, nil, err
+	}
+
+	fileDescs := []*model.FileDesc{}
+	for _, group := range groups {
+		groupDir, err := MaterializeSplitGroup(group, destDir)
+		if err != nil {
+			logs.GetLogger().Error(err)
+			return nil, nil, err
+		}
+
+		fileDescs = append(fileDescs, &model.FileDesc{
+			SourceFileName: group.Name,
+			SourceFilePath: groupDir,
+			SourceFileSize: group.Size,
+			CarFileName:    group.Name + CAR_FILE_EXTENSION,
+		})
+	}
+
+	logs.GetLogger().Info(srcPath, " split into ", len(groups), " groups under ", destDir)
+	return groups, fileDescs, nil
+}
+
+//whether path is dir or under dir, symlinks are not resolved
+func isPathInside(path, dir string) (bool, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return false, err
+	}
+
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return false, err
+	}
+
+	relPath, err := filepath.Rel(absDir, absPath)
+	if err != nil {
+		return false, nil
+	}
+
+	return relPath == "." || (relPath != ".." && !strings.HasPrefix(relPath, ".."+string(filepath.Separator))), nil
+}
+
+//generates the car file of each group in destCarDir and fills the car fields of its file desc
+func GenerateSplitCarFiles(ctx context.Context, fileDescs []*model.FileDesc, destCarDir string, carOptions *CarOptions) error {
+	for _, fileDesc := range fileDescs {
+		carFileDesc, err := GenerateCarFileDesc(ctx, fileDesc.SourceFilePath, destCarDir, carOptions)
+		if err != nil {
+			logs.GetLogger().Error(err)
+			return err
+		}
+
+		fileDesc.CarFileName = carFileDesc.CarFileName
+		fileDesc.CarFilePath = carFileDesc.CarFilePath
+		fileDesc.CarFileSize = carFileDesc.CarFileSize
+		fileDesc.PayloadCid = carFileDesc.PayloadCid
+		fileDesc.PieceCid = carFileDesc.PieceCid
+	}
+
+	return nil
+}
@@ -0,0 +1,438 @@
+package car
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/filswan/go-swan-lib/logs"
+
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+	cbor "github.com/ipfs/go-ipld-cbor"
+	ipld "github.com/ipfs/go-ipld-format"
+	"github.com/multiformats/go-multihash"
+)
+
+const (
+	CARV2_PRAGMA_SIZE                 = 11
+	CARV2_HEADER_SIZE                 = 40
+	CARV2_CHARACTERISTICS_SIZE        = 16
+	MULTICODEC_MULTIHASH_INDEX_SORTED = 0x0401
+	CAR_WRITE_BUFFER_SIZE             = 1024 * 1024
+)
+
+//fixed beginning of a carv2 file, the dag-cbor encoding of {version:2}
+var carV2Pragma = []byte{0x0a, 0xa1, 0x67, 0x76, 0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e, 0x02}
+
+type CarHeader struct {
+	Roots   []cid.Cid `refmt:"roots"`
+	Version uint64    `refmt:"version"`
+}
+
+func init() {
+	cbor.RegisterCborType(CarHeader{})
+}
+
+type blockPosition struct {
+	sectionOffset int64 // offset of the section from the start of the carv1 data
+	dataOffset    int64 // offset of the block data in the file
+	dataSize      int64
+}
+
+//an append only ipld.DAGService which writes blocks to a car file as they are added,
+//the carv1 header is reserved first and filled once the root is known
+type carWriter struct {
+	carFilePath string
+	carVersion  int
+	file        *os.File
+	writer      *bufio.Writer
+	dataOffset  int64 // offset of the carv1 data in the file
+	headerSize  int64 // size of the carv1 header, including its length prefix
+	blocksSize  int64 // size of the sections written
+	fileSize    int64
+	positions   map[string]*blockPosition
+	cids        []cid.Cid // in the order they are written
+	mutex       sync.Mutex
+}
+
+func createCarWriter(carFilePath string, carVersion int, cidBuilder cid.Builder) (*carWriter, error) {
+	//the root is built by the same builder, so its header has the same size
+	placeholderCid, err := cidBuilder.Sum(nil)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	header, err := encodeCarHeader(placeholderCid)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	file, err := os.Create(carFilePath)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	carWriter := &carWriter{
+		carFilePath: carFilePath,
+		carVersion:  carVersion,
+		file:        file,
+		writer:      bufio.NewWriterSize(file, CAR_WRITE_BUFFER_SIZE),
+		headerSize:  int64(len(header)),
+		positions:   map[string]*blockPosition{},
+	}
+
+	if carVersion == CAR_VERSION_2 {
+		carWriter.dataOffset = CARV2_PRAGMA_SIZE + CARV2_HEADER_SIZE
+	}
+
+	_, err = carWriter.writer.Write(make([]byte, carWriter.dataOffset+carWriter.headerSize))
+	if err != nil {
+		logs.GetLogger().Error(err)
+		carWriter.abort()
+		return nil, err
+	}
+
+	return carWriter, nil
+}
+
+//varint length prefixed dag-cbor header
+func encodeCarHeader(root cid.Cid) ([]byte, error) {
+	carHeader := &CarHeader{
+		Roots:   []cid.Cid{root},
+		Version: CAR_VERSION_1,
+	}
+
+	headerBytes, err := cbor.DumpObject(carHeader)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	header := make([]byte, binary.MaxVarintLen64, binary.MaxVarintLen64+len(headerBytes))
+	header = append(header[:binary.PutUvarint(header, uint64(len(headerBytes)))], headerBytes...)
+
+	return header, nil
+}
+
+func (carWriter *carWriter) Add(ctx context.Context, node ipld.Node) error {
+	carWriter.mutex.Lock()
+	defer carWriter.mutex.Unlock()
+
+	key := node.Cid().KeyString()
+	if _, ok := carWriter.positions[key]; ok {
+		return nil
+	}
+
+	cidBytes := node.Cid().Bytes()
+	data := node.RawData()
+	sectionSize := len(cidBytes) + len(data)
+
+	var lengthPrefix [binary.MaxVarintLen64]byte
+	lengthPrefixSize := binary.PutUvarint(lengthPrefix[:], uint64(sectionSize))
+
+	for _, bytes := range [][]byte{lengthPrefix[:lengthPrefixSize], cidBytes, data} {
+		_, err := carWriter.writer.Write(bytes)
+		if err != nil {
+			logs.GetLogger().Error(err)
+			return err
+		}
+	}
+
+	sectionOffset := carWriter.headerSize + carWriter.blocksSize
+	carWriter.positions[key] = &blockPosition{
+		sectionOffset: sectionOffset,
+		dataOffset:    carWriter.dataOffset + sectionOffset + int64(lengthPrefixSize+len(cidBytes)),
+		dataSize:      int64(len(data)),
+	}
+	carWriter.cids = append(carWriter.cids, node.Cid())
+	carWriter.blocksSize += int64(lengthPrefixSize + sectionSize)
+
+	return nil
+}
+
+func (carWriter *carWriter) AddMany(ctx context.Context, nodes []ipld.Node) error {
+	for _, node := range nodes {
+		err := carWriter.Add(ctx, node)
+		if err != nil {
+			logs.GetLogger().Error(err)
+			return err
+		}
+	}
+
+	return nil
+}
+
+//reads the block back from the file
+func (carWriter *carWriter) Get(ctx context.Context, c cid.Cid) (ipld.Node, error) {
+	carWriter.mutex.Lock()
+	defer carWriter.mutex.Unlock()
+
+	position, ok := carWriter.positions[c.KeyString()]
+	if !ok {
+		return nil, ipld.ErrNotFound
+	}
+
+	err := carWriter.writer.Flush()
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	data := make([]byte, position.dataSize)
+	_, err = carWriter.file.ReadAt(data, position.dataOffset)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	block, err := blocks.NewBlockWithCid(data, c)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	return ipld.Decode(block)
+}
+
+func (carWriter *carWriter) GetMany(ctx context.Context, cids []cid.Cid) <-chan *ipld.NodeOption {
+	nodeOptions := make(chan *ipld.NodeOption, len(cids))
+	for _, c := range cids {
+		node, err := carWriter.Get(ctx, c)
+		nodeOptions <- &ipld.NodeOption{Node: node, Err: err}
+	}
+	close(nodeOptions)
+
+	return nodeOptions
+}
+
+//blocks cannot be removed from a car file being written
+func (carWriter *carWriter) Remove(ctx context.Context, c cid.Cid) error {
+	return nil
+}
+
+func (carWriter *carWriter) RemoveMany(ctx context.Context, cids []cid.Cid) error {
+	return nil
+}
+
+func (carWriter *carWriter) finish(root cid.Cid) error {
+	header, err := encodeCarHeader(root)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	err = carWriter.writer.Flush()
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	if int64(len(header)) == carWriter.headerSize {
+		_, err = carWriter.file.WriteAt(header, carWriter.dataOffset)
+	} else {
+		err = carWriter.rewrite(header)
+	}
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	carWriter.fileSize = carWriter.dataOffset + carWriter.headerSize + carWriter.blocksSize
+
+	if carWriter.carVersion == CAR_VERSION_2 {
+		err = carWriter.writeCarV2Index()
+		if err != nil {
+			logs.GetLogger().Error(err)
+			return err
+		}
+	}
+
+	err = carWriter.file.Close()
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	return nil
+}
+
+//copies the sections after a header of a different size than reserved,
+//which only happens when the root is not built by the cid builder
+func (carWriter *carWriter) rewrite(header []byte) error {
+	tmpFile, err := os.CreateTemp(filepath.Dir(carWriter.carFilePath), filepath.Base(carWriter.carFilePath)+".*")
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+	defer os.Remove(tmpFile.Name())
+
+	writer := bufio.NewWriterSize(tmpFile, CAR_WRITE_BUFFER_SIZE)
+	_, err = writer.Write(append(make([]byte, carWriter.dataOffset), header...))
+	if err == nil {
+		sections := io.NewSectionReader(carWriter.file, carWriter.dataOffset+carWriter.headerSize, carWriter.blocksSize)
+		_, err = io.Copy(writer, sections)
+	}
+	if err == nil {
+		err = writer.Flush()
+	}
+	if err != nil {
+		logs.GetLogger().Error(err)
+		tmpFile.Close()
+		return err
+	}
+
+	carWriter.file.Close()
+	err = os.Rename(tmpFile.Name(), carWriter.carFilePath)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		tmpFile.Close()
+		return err
+	}
+
+	headerSizeChange := int64(len(header)) - carWriter.headerSize
+	for _, position := range carWriter.positions {
+		position.sectionOffset += headerSizeChange
+		position.dataOffset += headerSizeChange
+	}
+
+	carWriter.file = tmpFile
+	carWriter.writer = bufio.NewWriterSize(tmpFile, CAR_WRITE_BUFFER_SIZE)
+	carWriter.headerSize = int64(len(header))
+
+	return nil
+}
+
+//appends a MultihashIndexSorted index and writes the pragma and the carv2 header
+func (carWriter *carWriter) writeCarV2Index() error {
+	index, err := carWriter.getMultihashIndexSorted()
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	_, err = carWriter.file.WriteAt(index, carWriter.fileSize)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	indexOffset := carWriter.fileSize
+	carWriter.fileSize += int64(len(index))
+
+	header := make([]byte, CARV2_PRAGMA_SIZE+CARV2_HEADER_SIZE)
+	copy(header, carV2Pragma)
+	headerFields := header[CARV2_PRAGMA_SIZE+CARV2_CHARACTERISTICS_SIZE:]
+	binary.LittleEndian.PutUint64(headerFields[0:], uint64(carWriter.dataOffset))
+	binary.LittleEndian.PutUint64(headerFields[8:], uint64(carWriter.headerSize+carWriter.blocksSize))
+	binary.LittleEndian.PutUint64(headerFields[16:], uint64(indexOffset))
+
+	_, err = carWriter.file.WriteAt(header, 0)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	return nil
+}
+
+type indexEntry struct {
+	digest []byte
+	offset uint64
+}
+
+//multicodec varint, then entries grouped by multihash code and digest size, each group sorted by digest,
+//offsets are of the sections from the start of the carv1 data
+func (carWriter *carWriter) getMultihashIndexSorted() ([]byte, error) {
+	entriesByCode := map[uint64]map[uint32][]indexEntry{}
+	for _, c := range carWriter.cids {
+		decodedMultihash, err := multihash.Decode(c.Hash())
+		if err != nil {
+			logs.GetLogger().Error(err)
+			return nil, err
+		}
+
+		entriesByWidth, ok := entriesByCode[decodedMultihash.Code]
+		if !ok {
+			entriesByWidth = map[uint32][]indexEntry{}
+			entriesByCode[decodedMultihash.Code] = entriesByWidth
+		}
+
+		//width is the size of an entry, digest plus offset
+		width := uint32(len(decodedMultihash.Digest) + 8)
+		entriesByWidth[width] = append(entriesByWidth[width], indexEntry{
+			digest: decodedMultihash.Digest,
+			offset: uint64(carWriter.positions[c.KeyString()].sectionOffset),
+		})
+	}
+
+	index := make([]byte, binary.MaxVarintLen64)
+	index = index[:binary.PutUvarint(index, MULTICODEC_MULTIHASH_INDEX_SORTED)]
+	index = appendUint32(index, uint32(len(entriesByCode)))
+
+	for _, code := range getSortedKeys(entriesByCode) {
+		entriesByWidth := entriesByCode[code]
+		index = appendUint64(index, code)
+		index = appendUint32(index, uint32(len(entriesByWidth)))
+
+		widths := []uint32{}
+		for width := range entriesByWidth {
+			widths = append(widths, width)
+		}
+		sort.Slice(widths, func(i, j int) bool { return widths[i] < widths[j] })
+
+		for _, width := range widths {
+			entries := entriesByWidth[width]
+			sort.Slice(entries, func(i, j int) bool { return string(entries[i].digest) < string(entries[j].digest) })
+
+			index = appendUint32(index, width)
+			index = appendUint64(index, uint64(len(entries))*uint64(width))
+			for _, entry := range entries {
+				index = append(index, entry.digest...)
+				index = appendUint64(index, entry.offset)
+			}
+		}
+	}
+
+	return index, nil
+}
+
+func getSortedKeys(entriesByCode map[uint64]map[uint32][]indexEntry) []uint64 {
+	codes := []uint64{}
+	for code := range entriesByCode {
+		codes = append(codes, code)
+	}
+	sort.Slice(codes, func(i, j int) bool { return codes[i] < codes[j] })
+
+	return codes
+}
+
+func appendUint32(bytes []byte, value uint32) []byte {
+	var buf [4]byte
+	binary.LittleEndian.PutUint32(buf[:], value)
+	return append(bytes, buf[:]...)
+}
+
+func appendUint64(bytes []byte, value uint64) []byte {
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], value)
+	return append(bytes, buf[:]...)
+}
+
+//closes and removes the car file
+func (carWriter *carWriter) abort() {
+	carWriter.file.Close()
+
+	err := os.Remove(carWriter.carFilePath)
+	if err != nil {
+		logs.GetLogger().Error(err)
+	}
+}
@@ -1,8 +1,12 @@
 package client
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"strconv"
+	"sync/atomic"
 
 	"github.com/filswan/go-swan-lib/client/web"
 	"github.com/filswan/go-swan-lib/logs"
@@ -11,6 +15,38 @@ import (
 const ADD_URI = "aria2.addUri"
 const STATUS = "aria2.tellStatus"
 
+const (
+	ARIA2_METHOD_PAUSE                  = "aria2.pause"
+	ARIA2_METHOD_FORCE_PAUSE            = "aria2.forcePause"
+	ARIA2_METHOD_UNPAUSE                = "aria2.unpause"
+	ARIA2_METHOD_REMOVE                 = "aria2.remove"
+	ARIA2_METHOD_FORCE_REMOVE           = "aria2.forceRemove"
+	ARIA2_METHOD_TELL_ACTIVE            = "aria2.tellActive"
+	ARIA2_METHOD_TELL_WAITING           = "aria2.tellWaiting"
+	ARIA2_METHOD_TELL_STOPPED           = "aria2.tellStopped"
+	ARIA2_METHOD_GET_GLOBAL_STAT        = "aria2.getGlobalStat"
+	ARIA2_METHOD_CHANGE_OPTION          = "aria2.changeOption"
+	ARIA2_METHOD_PURGE_DOWNLOAD_RESULT  = "aria2.purgeDownloadResult"
+	ARIA2_METHOD_REMOVE_DOWNLOAD_RESULT = "aria2.removeDownloadResult"
+
+	ARIA2_JSON_RPC_VERSION = "2.0"
+	ARIA2_RESULT_OK        = "OK"
+)
+
+var ErrAria2EmptyResult = errors.New("aria2 empty result")
+
+//methods changing the download queue, they are never retried
+var nonIdempotentAria2Methods = map[string]bool{
+	ADD_URI:                   true,
+	ARIA2_METHOD_PAUSE:        true,
+	ARIA2_METHOD_FORCE_PAUSE:  true,
+	ARIA2_METHOD_UNPAUSE:      true,
+	ARIA2_METHOD_REMOVE:       true,
+	ARIA2_METHOD_FORCE_REMOVE: true,
+}
+
+var aria2RequestId int64
+
 type JsonRpcParams struct {
 	JsonRpc string        `json:"jsonrpc"`
 	Method  string        `json:"method"`
@@ -26,15 +62,19 @@ type Aria2Payload struct {
 }
 
 type Aria2Client struct {
-	Host      string
-	port      int
-	token     string
-	serverUrl string
+	Host              string
+	RetryPolicy       *web.RetryPolicy // applied to status queries only, nil means no retry
+	WsReconnectPolicy *web.RetryPolicy // restores the websocket of Notify, nil means no reconnection
+	port              int
+	token             string
+	serverUrl         string
 }
 
 type Aria2DownloadOption struct {
-	Out string `json:"out"`
-	Dir string `json:"dir"`
+	Out      string   `json:"out,omitempty"`
+	Dir      string   `json:"dir,omitempty"`
+	Header   []string `json:"header,omitempty"`   // such as "Authorization: Bearer [token]" for authenticated urls
+	Checksum string   `json:"checksum,omitempty"` // [type]=[hex digest] verified once downloaded, such as md5=[digest] or sha-256=[digest]
 }
 
 type Aria2Status struct {
@@ -56,6 +96,26 @@ type Aria2Error struct {
 	Message string `json:"message"`
 }
 
+func (e *Aria2Error) Error() string {
+	return fmt.Sprintf("aria2 error, code:%d, message:%s", e.Code, e.Message)
+}
+
+type aria2Response struct {
+	Id      string          `json:"id"`
+	JsonRpc string          `json:"jsonrpc"`
+	Result  json.RawMessage `json:"result"`
+	Error   *Aria2Error     `json:"error"`
+}
+
+type Aria2GlobalStat struct {
+	DownloadSpeed   string `json:"downloadSpeed"`
+	UploadSpeed     string `json:"uploadSpeed"`
+	NumActive       string `json:"numActive"`
+	NumWaiting      string `json:"numWaiting"`
+	NumStopped      string `json:"numStopped"`
+	NumStoppedTotal string `json:"numStoppedTotal"`
+}
+
 type Aria2StatusResult struct {
 	Bitfield        string                  `json:"bitfield"`
 	CompletedLength string                  `json:"completedLength"`
@@ -90,9 +150,11 @@ type Aria2StatusResultFileUri struct {
 
 func GetAria2Client(aria2Host, aria2Secret string, aria2Port int) *Aria2Client {
 	aria2cClient := &Aria2Client{
-		Host:  aria2Host,
-		port:  aria2Port,
-		token: aria2Secret,
+		Host:              aria2Host,
+		RetryPolicy:       web.DefaultRetryPolicy(),
+		WsReconnectPolicy: web.DefaultRetryPolicy(),
+		port:              aria2Port,
+		token:             aria2Secret,
 	}
 
 	aria2cClient.serverUrl = fmt.Sprintf("http://%s:%d/jsonrpc", aria2cClient.Host, aria2cClient.port)
@@ -123,23 +185,20 @@ func (aria2Client *Aria2Client) GenPayload4Download(method string, uri string, o
 	return payload
 }
 
-func (aria2Client *Aria2Client) DownloadFile(uri string, outDir, outFilename string) *Aria2Download {
-	payload := aria2Client.GenPayload4Download(ADD_URI, uri, outDir, outFilename)
-
-	response, err := web.HttpPostNoToken(aria2Client.serverUrl, payload)
+//the returned error is an *Aria2Error when aria2 rejects the download
+func (aria2Client *Aria2Client) DownloadFile(uri string, outDir, outFilename string) (*Aria2Download, error) {
+	gid, err := aria2Client.AddUri(context.Background(), []string{uri}, &Aria2DownloadOption{Out: outFilename, Dir: outDir})
 	if err != nil {
 		logs.GetLogger().Error(err)
-		return nil
+		return nil, err
 	}
 
-	aria2Download := &Aria2Download{}
-	err = json.Unmarshal(response, aria2Download)
-	if err != nil {
-		logs.GetLogger().Error(err)
-		return nil
+	aria2Download := &Aria2Download{
+		JsonRpc: ARIA2_JSON_RPC_VERSION,
+		Gid:     gid,
 	}
 
-	return aria2Download
+	return aria2Download, nil
 }
 
 func (aria2Client *Aria2Client) GenPayload4Status(gid string) Aria2Payload {
@@ -156,20 +215,240 @@ func (aria2Client *Aria2Client) GenPayload4Status(gid string) Aria2Payload {
 	return payload
 }
 
-func (aria2Client *Aria2Client) GetDownloadStatus(gid string) *Aria2Status {
-	payload := aria2Client.GenPayload4Status(gid)
-	response, err := web.HttpPostNoToken(aria2Client.serverUrl, payload)
+//the returned error is an *Aria2Error when aria2 does not know the gid
+func (aria2Client *Aria2Client) GetDownloadStatus(gid string) (*Aria2Status, error) {
+	aria2StatusResult, err := aria2Client.TellStatus(context.Background(), gid)
 	if err != nil {
 		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	aria2Status := &Aria2Status{
+		JsonRpc: ARIA2_JSON_RPC_VERSION,
+		Result:  aria2StatusResult,
+	}
+
+	return aria2Status, nil
+}
+
+func getAria2RequestId() string {
+	return strconv.FormatInt(atomic.AddInt64(&aria2RequestId, 1), 10)
+}
+
+//calls method and decodes its result into result, which should be a pointer or nil,
+//errors reported by aria2 are returned as *Aria2Error, methods changing the download queue are not retried
+func (aria2Client *Aria2Client) call(ctx context.Context, method string, result interface{}, params ...interface{}) error {
+	payload := Aria2Payload{
+		JsonRpc: ARIA2_JSON_RPC_VERSION,
+		Id:      getAria2RequestId(),
+		Method:  method,
+		Params:  append([]interface{}{"token:" + aria2Client.token}, params...),
+	}
+
+	var retryPolicy *web.RetryPolicy
+	if !nonIdempotentAria2Methods[method] {
+		retryPolicy = aria2Client.RetryPolicy
+	}
+
+	var response []byte
+	err := retryPolicy.Do(ctx, func() error {
+		var err error
+		response, err = web.GetDefaultClient().Post(ctx, aria2Client.serverUrl, "", payload)
+		return err
+	})
+
+	aria2Response := &aria2Response{}
+	if err != nil {
+		//aria2 answers errors with http status 400 and the json-rpc error as body
+		var httpStatusError *web.HTTPStatusError
+		if !errors.As(err, &httpStatusError) || json.Unmarshal([]byte(httpStatusError.Message), aria2Response) != nil || aria2Response.Error == nil {
+			logs.GetLogger().Error(err)
+			return err
+		}
+	} else {
+		err = json.Unmarshal(response, aria2Response)
+		if err != nil {
+			logs.GetLogger().Error(err)
+			return err
+		}
+	}
+
+	if aria2Response.Error != nil {
+		logs.GetLogger().Error(method, " failed, ", aria2Response.Error)
+		return aria2Response.Error
+	}
+
+	if result == nil {
 		return nil
 	}
 
-	aria2Status := &Aria2Status{}
-	err = json.Unmarshal(response, aria2Status)
+	if len(aria2Response.Result) == 0 || string(aria2Response.Result) == "null" {
+		err := fmt.Errorf("%s: %w from %s", method, ErrAria2EmptyResult, aria2Client.serverUrl)
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	err = json.Unmarshal(aria2Response.Result, result)
 	if err != nil {
 		logs.GetLogger().Error(err)
-		return nil
+		return err
+	}
+
+	return nil
+}
+
+//returns the gid of the new download, uris are mirrors of the same file, nil aria2DownloadOption means the aria2 defaults
+func (aria2Client *Aria2Client) AddUri(ctx context.Context, uris []string, aria2DownloadOption *Aria2DownloadOption) (string, error) {
+	params := []interface{}{uris}
+	if aria2DownloadOption != nil {
+		params = append(params, aria2DownloadOption)
+	}
+
+	var gid string
+	err := aria2Client.call(ctx, ADD_URI, &gid, params...)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return "", err
+	}
+
+	return gid, nil
+}
+
+//keys limits the returned fields, all fields are returned when empty
+func (aria2Client *Aria2Client) TellStatus(ctx context.Context, gid string, keys ...string) (*Aria2StatusResult, error) {
+	params := []interface{}{gid}
+	if len(keys) > 0 {
+		params = append(params, keys)
+	}
+
+	aria2StatusResult := &Aria2StatusResult{}
+	err := aria2Client.call(ctx, STATUS, aria2StatusResult, params...)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	return aria2StatusResult, nil
+}
+
+//the download keeps its progress and can be resumed by Unpause,
+//with force the connections are closed without waiting
+func (aria2Client *Aria2Client) Pause(ctx context.Context, gid string, force bool) (string, error) {
+	method := ARIA2_METHOD_PAUSE
+	if force {
+		method = ARIA2_METHOD_FORCE_PAUSE
+	}
+
+	return aria2Client.callGid(ctx, method, gid)
+}
+
+func (aria2Client *Aria2Client) Unpause(ctx context.Context, gid string) (string, error) {
+	return aria2Client.callGid(ctx, ARIA2_METHOD_UNPAUSE, gid)
+}
+
+//the download is stopped and its result is kept until RemoveDownloadResult or PurgeDownloadResult,
+//with force the connections are closed without waiting
+func (aria2Client *Aria2Client) Remove(ctx context.Context, gid string, force bool) (string, error) {
+	method := ARIA2_METHOD_REMOVE
+	if force {
+		method = ARIA2_METHOD_FORCE_REMOVE
+	}
+
+	return aria2Client.callGid(ctx, method, gid)
+}
+
+//methods taking a gid and returning it
+func (aria2Client *Aria2Client) callGid(ctx context.Context, method, gid string) (string, error) {
+	var resultGid string
+	err := aria2Client.call(ctx, method, &resultGid, gid)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return "", err
+	}
+
+	return resultGid, nil
+}
+
+func (aria2Client *Aria2Client) TellActive(ctx context.Context, keys ...string) ([]*Aria2StatusResult, error) {
+	params := []interface{}{}
+	if len(keys) > 0 {
+		params = append(params, keys)
+	}
+
+	return aria2Client.tellStatuses(ctx, ARIA2_METHOD_TELL_ACTIVE, params)
+}
+
+//offset is the position in the waiting queue, a negative offset counts from its end and returns the downloads in reverse order
+func (aria2Client *Aria2Client) TellWaiting(ctx context.Context, offset, num int, keys ...string) ([]*Aria2StatusResult, error) {
+	params := []interface{}{offset, num}
+	if len(keys) > 0 {
+		params = append(params, keys)
+	}
+
+	return aria2Client.tellStatuses(ctx, ARIA2_METHOD_TELL_WAITING, params)
+}
+
+//the completed, failed and removed downloads, offset works as in TellWaiting
+func (aria2Client *Aria2Client) TellStopped(ctx context.Context, offset, num int, keys ...string) ([]*Aria2StatusResult, error) {
+	params := []interface{}{offset, num}
+	if len(keys) > 0 {
+		params = append(params, keys)
+	}
+
+	return aria2Client.tellStatuses(ctx, ARIA2_METHOD_TELL_STOPPED, params)
+}
+
+func (aria2Client *Aria2Client) tellStatuses(ctx context.Context, method string, params []interface{}) ([]*Aria2StatusResult, error) {
+	aria2StatusResults := []*Aria2StatusResult{}
+	err := aria2Client.call(ctx, method, &aria2StatusResults, params...)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	return aria2StatusResults, nil
+}
+
+func (aria2Client *Aria2Client) GetGlobalStat(ctx context.Context) (*Aria2GlobalStat, error) {
+	aria2GlobalStat := &Aria2GlobalStat{}
+	err := aria2Client.call(ctx, ARIA2_METHOD_GET_GLOBAL_STAT, aria2GlobalStat)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	return aria2GlobalStat, nil
+}
+
+//options are aria2 input file options, such as max-download-limit, some of them restart an active download
+func (aria2Client *Aria2Client) ChangeOption(ctx context.Context, gid string, options map[string]string) error {
+	return aria2Client.callOk(ctx, ARIA2_METHOD_CHANGE_OPTION, gid, options)
+}
+
+//removes the results of all the completed, failed and removed downloads
+func (aria2Client *Aria2Client) PurgeDownloadResult(ctx context.Context) error {
+	return aria2Client.callOk(ctx, ARIA2_METHOD_PURGE_DOWNLOAD_RESULT)
+}
+
+//removes the result of a completed, failed or removed download, so that the same file can be added again
+func (aria2Client *Aria2Client) RemoveDownloadResult(ctx context.Context, gid string) error {
+	return aria2Client.callOk(ctx, ARIA2_METHOD_REMOVE_DOWNLOAD_RESULT, gid)
+}
+
+//methods returning OK
+func (aria2Client *Aria2Client) callOk(ctx context.Context, method string, params ...interface{}) error {
+	var result string
+	err := aria2Client.call(ctx, method, &result, params...)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	if result != ARIA2_RESULT_OK {
+		err := fmt.Errorf("%s: unexpected result:%s", method, result)
+		logs.GetLogger().Error(err)
+		return err
 	}
 
-	return aria2Status
+	return nil
 }
@@ -0,0 +1,240 @@
+package client
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/filswan/go-swan-lib/logs"
+)
+
+//status of an aria2 download, as reported in Aria2StatusResult.Status
+type Aria2DownloadState int
+
+const (
+	Aria2DownloadUnknown Aria2DownloadState = iota
+	Aria2DownloadActive
+	Aria2DownloadWaiting
+	Aria2DownloadPaused
+	Aria2DownloadError
+	Aria2DownloadComplete
+	Aria2DownloadRemoved
+)
+
+var aria2DownloadStateNames = map[Aria2DownloadState]string{
+	Aria2DownloadUnknown:  "unknown",
+	Aria2DownloadActive:   "active",
+	Aria2DownloadWaiting:  "waiting",
+	Aria2DownloadPaused:   "paused",
+	Aria2DownloadError:    "error",
+	Aria2DownloadComplete: "complete",
+	Aria2DownloadRemoved:  "removed",
+}
+
+func GetAria2DownloadState(status string) Aria2DownloadState {
+	for state, name := range aria2DownloadStateNames {
+		if name == status {
+			return state
+		}
+	}
+
+	return Aria2DownloadUnknown
+}
+
+func (state Aria2DownloadState) String() string {
+	name, ok := aria2DownloadStateNames[state]
+	if !ok {
+		return fmt.Sprintf("Aria2DownloadState(%d)", int(state))
+	}
+
+	return name
+}
+
+//error, complete and removed downloads are stopped, they are listed by TellStopped
+func (state Aria2DownloadState) IsStopped() bool {
+	return state == Aria2DownloadError || state == Aria2DownloadComplete || state == Aria2DownloadRemoved
+}
+
+//the fields of Aria2StatusResult parsed, fields not returned by aria2 are 0
+type Aria2DownloadProgress struct {
+	Gid             string
+	State           Aria2DownloadState
+	TotalLength     int64
+	CompletedLength int64
+	UploadLength    int64
+	DownloadSpeed   int64 // bytes/s
+	UploadSpeed     int64 // bytes/s
+	Connections     int
+	NumPieces       int
+	PieceLength     int64
+	ErrorCode       int
+	ErrorMessage    string
+	Dir             string
+	Percent         float64       // 0 when the total length is unknown
+	Eta             time.Duration // -1 when the total length is unknown or nothing is downloading
+	Pieces          []bool        // completion of each piece decoded from the bitfield, nil when aria2 did not return it
+	CompletedPieces int
+	Files           []*Aria2DownloadProgressFile
+}
+
+type Aria2DownloadProgressFile struct {
+	Index           int
+	Path            string
+	Length          int64
+	CompletedLength int64
+	Selected        bool
+	Uris            []Aria2StatusResultFileUri
+}
+
+func (aria2StatusResult *Aria2StatusResult) GetProgress() (*Aria2DownloadProgress, error) {
+	progress := &Aria2DownloadProgress{
+		Gid:          aria2StatusResult.Gid,
+		State:        GetAria2DownloadState(aria2StatusResult.Status),
+		ErrorMessage: aria2StatusResult.ErrorMessage,
+		Dir:          aria2StatusResult.Dir,
+		Eta:          -1,
+	}
+
+	var err error
+	int64Fields := []struct {
+		name  string
+		value string
+		field *int64
+	}{
+		{"totalLength", aria2StatusResult.TotalLength, &progress.TotalLength},
+		{"completedLength", aria2StatusResult.CompletedLength, &progress.CompletedLength},
+		{"uploadLength", aria2StatusResult.UploadLength, &progress.UploadLength},
+		{"downloadSpeed", aria2StatusResult.DownloadSpeed, &progress.DownloadSpeed},
+		{"uploadSpeed", aria2StatusResult.UploadSpeed, &progress.UploadSpeed},
+		{"pieceLength", aria2StatusResult.PieceLength, &progress.PieceLength},
+	}
+	for _, int64Field := range int64Fields {
+		*int64Field.field, err = parseAria2Int64(int64Field.name, int64Field.value)
+		if err != nil {
+			logs.GetLogger().Error(err)
+			return nil, err
+		}
+	}
+
+	intFields := []struct {
+		name  string
+		value string
+		field *int
+	}{
+		{"connections", aria2StatusResult.Connections, &progress.Connections},
+		{"numPieces", aria2StatusResult.NumPieces, &progress.NumPieces},
+		{"errorCode", aria2StatusResult.ErrorCode, &progress.ErrorCode},
+	}
+	for _, intField := range intFields {
+		value, err := parseAria2Int64(intField.name, intField.value)
+		if err != nil {
+			logs.GetLogger().Error(err)
+			return nil, err
+		}
+		*intField.field = int(value)
+	}
+
+	if progress.TotalLength > 0 {
+		progress.Percent = float64(progress.CompletedLength) * 100 / float64(progress.TotalLength)
+		if progress.DownloadSpeed > 0 {
+			remainingSeconds := float64(progress.TotalLength-progress.CompletedLength) / float64(progress.DownloadSpeed)
+			progress.Eta = time.Duration(remainingSeconds * float64(time.Second))
+		}
+	}
+
+	if aria2StatusResult.Bitfield != "" {
+		progress.Pieces, err = DecodeAria2Bitfield(aria2StatusResult.Bitfield, progress.NumPieces)
+		if err != nil {
+			logs.GetLogger().Error(err)
+			return nil, err
+		}
+
+		for _, completed := range progress.Pieces {
+			if completed {
+				progress.CompletedPieces++
+			}
+		}
+	}
+
+	for _, file := range aria2StatusResult.Files {
+		progressFile, err := file.getProgressFile()
+		if err != nil {
+			logs.GetLogger().Error(err)
+			return nil, err
+		}
+		progress.Files = append(progress.Files, progressFile)
+	}
+
+	return progress, nil
+}
+
+func (file *Aria2StatusResultFile) getProgressFile() (*Aria2DownloadProgressFile, error) {
+	index, err := parseAria2Int64("index", file.Index)
+	if err != nil {
+		return nil, err
+	}
+
+	length, err := parseAria2Int64("length", file.Length)
+	if err != nil {
+		return nil, err
+	}
+
+	completedLength, err := parseAria2Int64("completedLength", file.CompletedLength)
+	if err != nil {
+		return nil, err
+	}
+
+	progressFile := &Aria2DownloadProgressFile{
+		Index:           int(index),
+		Path:            file.Path,
+		Length:          length,
+		CompletedLength: completedLength,
+		Selected:        file.Selected == "true",
+		Uris:            file.Uris,
+	}
+
+	return progressFile, nil
+}
+
+//aria2 omits the fields not in the keys of the request, they are parsed as 0
+func parseAria2Int64(name, value string) (int64, error) {
+	if value == "" {
+		return 0, nil
+	}
+
+	result, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s:%s, %w", name, value, err)
+	}
+
+	return result, nil
+}
+
+//the bitfield is in hex, the highest bit of the first byte is the first piece,
+//numPieces drops the padding bits of the last byte, all the bits are returned when it is 0
+func DecodeAria2Bitfield(bitfield string, numPieces int) ([]bool, error) {
+	bitfieldBytes, err := hex.DecodeString(bitfield)
+	if err != nil {
+		err := fmt.Errorf("invalid bitfield:%s, %w", bitfield, err)
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	if numPieces <= 0 {
+		numPieces = len(bitfieldBytes) * 8
+	}
+
+	if numPieces > len(bitfieldBytes)*8 {
+		err := fmt.Errorf("bitfield of %d bits is shorter than %d pieces", len(bitfieldBytes)*8, numPieces)
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	pieces := make([]bool, numPieces)
+	for i := range pieces {
+		pieces[i] = bitfieldBytes[i/8]&(0x80>>uint(i%8)) != 0
+	}
+
+	return pieces, nil
+}
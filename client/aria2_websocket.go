@@ -0,0 +1,195 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/filswan/go-swan-lib/client/web"
+	"github.com/filswan/go-swan-lib/logs"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	ARIA2_EVENT_DOWNLOAD_START       = "aria2.onDownloadStart"
+	ARIA2_EVENT_DOWNLOAD_PAUSE       = "aria2.onDownloadPause"
+	ARIA2_EVENT_DOWNLOAD_STOP        = "aria2.onDownloadStop"
+	ARIA2_EVENT_DOWNLOAD_COMPLETE    = "aria2.onDownloadComplete"
+	ARIA2_EVENT_DOWNLOAD_ERROR       = "aria2.onDownloadError"
+	ARIA2_EVENT_BT_DOWNLOAD_COMPLETE = "aria2.onBtDownloadComplete"
+	ARIA2_EVENT_PREFIX               = "aria2.on"
+
+	ARIA2_EVENT_BUFFER             = 16
+	ARIA2_EVENT_QUEUE              = 1024 // events read and waiting for their status, the websocket is not read when it is full
+	ARIA2_EVENT_STATUS_TIMEOUT_SEC = 5
+	ARIA2_WS_HANDSHAKE_TIMEOUT_SEC = 30
+)
+
+type Aria2Event struct {
+	Method      string // ARIA2_EVENT_*
+	Gid         string
+	Status      *Aria2StatusResult // status of the download after the event, nil when StatusError is set
+	StatusError error
+}
+
+type aria2Notification struct {
+	Method string `json:"method"`
+	Params []struct {
+		Gid string `json:"gid"`
+	} `json:"params"`
+}
+
+func (aria2Client *Aria2Client) getWsUrl() string {
+	return strings.Replace(aria2Client.serverUrl, "http://", "ws://", 1)
+}
+
+func (aria2Client *Aria2Client) dialWs(ctx context.Context) (*websocket.Conn, error) {
+	dialer := &websocket.Dialer{
+		Proxy:            http.ProxyFromEnvironment,
+		HandshakeTimeout: ARIA2_WS_HANDSHAKE_TIMEOUT_SEC * time.Second,
+	}
+
+	wsUrl := aria2Client.getWsUrl()
+	conn, response, err := dialer.DialContext(ctx, wsUrl, nil)
+	if err != nil {
+		if response != nil {
+			err = &web.HTTPStatusError{
+				StatusCode: response.StatusCode,
+				Status:     response.Status,
+				Url:        wsUrl,
+			}
+		}
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	return conn, nil
+}
+
+//connects to the websocket of aria2 and delivers its download events with the status of the download,
+//the connection is restored according to aria2Client.WsReconnectPolicy when it is lost, events sent meanwhile are missed,
+//the returned channel is closed when ctx is done or the connection cannot be restored
+func (aria2Client *Aria2Client) Notify(ctx context.Context) (<-chan *Aria2Event, error) {
+	conn, err := aria2Client.dialWs(ctx)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	events := make(chan *Aria2Event, ARIA2_EVENT_BUFFER)
+	go aria2Client.runNotify(ctx, conn, events)
+
+	return events, nil
+}
+
+func (aria2Client *Aria2Client) runNotify(ctx context.Context, conn *websocket.Conn, events chan<- *Aria2Event) {
+	queuedEvents := make(chan *Aria2Event, ARIA2_EVENT_QUEUE)
+	defer close(queuedEvents)
+	go aria2Client.resolveEvents(ctx, queuedEvents, events)
+
+	for {
+		done := make(chan struct{})
+		go func(conn *websocket.Conn) {
+			select {
+			case <-ctx.Done():
+				conn.Close()
+			case <-done:
+			}
+		}(conn)
+
+		err := aria2Client.readNotifications(ctx, conn, queuedEvents)
+		close(done)
+		conn.Close()
+		if ctx.Err() != nil {
+			return
+		}
+
+		logs.GetLogger().Error("aria2 websocket connection lost:", err)
+		conn, err = aria2Client.reconnectWs(ctx)
+		if err != nil {
+			logs.GetLogger().Error(err)
+			return
+		}
+	}
+}
+
+func (aria2Client *Aria2Client) readNotifications(ctx context.Context, conn *websocket.Conn, events chan<- *Aria2Event) error {
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return err
+		}
+
+		notification := &aria2Notification{}
+		err = json.Unmarshal(data, notification)
+		if err != nil {
+			logs.GetLogger().Error(err)
+			continue
+		}
+
+		if !strings.HasPrefix(notification.Method, ARIA2_EVENT_PREFIX) {
+			continue
+		}
+
+		for _, param := range notification.Params {
+			event := &Aria2Event{
+				Method: notification.Method,
+				Gid:    param.Gid,
+			}
+
+			select {
+			case events <- event:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	}
+}
+
+//gets the status of the events in order and delivers them, it runs apart from the websocket reader,
+//so that a slow rpc endpoint does not stop the websocket from being read, events is closed when queuedEvents is
+func (aria2Client *Aria2Client) resolveEvents(ctx context.Context, queuedEvents <-chan *Aria2Event, events chan<- *Aria2Event) {
+	defer close(events)
+
+	for event := range queuedEvents {
+		statusCtx, cancel := context.WithTimeout(ctx, ARIA2_EVENT_STATUS_TIMEOUT_SEC*time.Second)
+		event.Status, event.StatusError = aria2Client.TellStatus(statusCtx, event.Gid)
+		cancel()
+
+		select {
+		case events <- event:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (aria2Client *Aria2Client) reconnectWs(ctx context.Context) (*websocket.Conn, error) {
+	if aria2Client.WsReconnectPolicy == nil {
+		err := fmt.Errorf("no reconnect policy for the aria2 websocket")
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	reconnectPolicy := *aria2Client.WsReconnectPolicy
+	reconnectPolicy.IsRetryable = func(err error) bool {
+		return true
+	}
+
+	var conn *websocket.Conn
+	err := reconnectPolicy.Do(ctx, func() error {
+		var err error
+		conn, err = aria2Client.dialWs(ctx)
+		return err
+	})
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	logs.GetLogger().Info("aria2 websocket reconnected to ", aria2Client.getWsUrl())
+	return conn, nil
+}
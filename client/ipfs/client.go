@@ -0,0 +1,593 @@
+package ipfs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/filswan/go-swan-lib/client/web"
+	"github.com/filswan/go-swan-lib/logs"
+	"github.com/filswan/go-swan-lib/model"
+	"github.com/filswan/go-swan-lib/utils"
+)
+
+const (
+	IPFS_PIN_TYPE_ALL       = "all"
+	IPFS_PIN_TYPE_RECURSIVE = "recursive"
+	IPFS_PIN_TYPE_DIRECT    = "direct"
+	IPFS_PIN_TYPE_INDIRECT  = "indirect"
+
+	IPFS_PIN_STATUS_PINNED   = "pinned"
+	IPFS_PIN_STATUS_UNPINNED = "unpinned"
+
+	//statuses of pins on remote pinning services
+	IPFS_REMOTE_PIN_STATUS_QUEUED  = "queued"
+	IPFS_REMOTE_PIN_STATUS_PINNING = "pinning"
+	IPFS_REMOTE_PIN_STATUS_PINNED  = "pinned"
+	IPFS_REMOTE_PIN_STATUS_FAILED  = "failed"
+
+	IPFS_TIMEOUT_SECOND_DEFAULT = 300
+	IPFS_ERROR_NOT_PINNED       = "is not pinned"
+)
+
+type IpfsClient struct {
+	ApiUrl        string
+	GatewayUrl    string
+	TimeoutSecond int              // of each api call, not applied to GatewayCat and DagImport whose duration depends on the data size
+	RetryPolicy   *web.RetryPolicy // applied to api calls other than DagImport and ipfsNonIdempotentCommands, nil means no retry
+}
+
+//commands which must not be sent twice, they are never retried,
+//a second pin/remote/add adds another remote pin, and a second pin/rm fails when the first one succeeded
+var ipfsNonIdempotentCommands = map[string]bool{
+	"pin/remote/add": true,
+	"pin/rm":         true,
+	"pin/remote/rm":  true,
+}
+
+type IpfsPin struct {
+	Cid  string
+	Type string
+}
+
+type IpfsRemotePin struct {
+	Cid    string
+	Name   string
+	Status string
+}
+
+type IpfsRemotePinService struct {
+	Service     string
+	ApiEndpoint string
+}
+
+type IpfsDagStat struct {
+	Size      int64
+	NumBlocks int64
+}
+
+type IpfsBlockStat struct {
+	Key  string
+	Size int64
+}
+
+type IpfsFilesStat struct {
+	Hash           string
+	Size           int64
+	CumulativeSize int64
+	Blocks         int
+	Type           string
+}
+
+type IpfsDagImportRoot struct {
+	Cid         string
+	PinErrorMsg string
+}
+
+func GetIpfsClient(apiUrl, gatewayUrl string, timeoutSecond int) (*IpfsClient, error) {
+	if len(apiUrl) == 0 {
+		err := fmt.Errorf("ipfs api url is required")
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	if timeoutSecond <= 0 {
+		timeoutSecond = IPFS_TIMEOUT_SECOND_DEFAULT
+	}
+
+	ipfsClient := &IpfsClient{
+		ApiUrl:        apiUrl,
+		GatewayUrl:    gatewayUrl,
+		TimeoutSecond: timeoutSecond,
+		RetryPolicy:   web.DefaultRetryPolicy(),
+	}
+
+	return ipfsClient, nil
+}
+
+//posts api/v0/[command] and returns the response body, every ipfs api is sent by POST
+func (ipfsClient *IpfsClient) call(ctx context.Context, command string, query url.Values) ([]byte, error) {
+	if ipfsClient.TimeoutSecond > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(ipfsClient.TimeoutSecond)*time.Second)
+		defer cancel()
+	}
+
+	apiUrlFull := utils.UrlJoin(ipfsClient.ApiUrl, "api/v0", command) + "?" + query.Encode()
+
+	var retryPolicy *web.RetryPolicy
+	if !ipfsNonIdempotentCommands[command] {
+		retryPolicy = ipfsClient.RetryPolicy
+	}
+
+	if retryPolicy != nil && retryPolicy.IsRetryable == nil {
+		ipfsRetryPolicy := *retryPolicy
+		ipfsRetryPolicy.IsRetryable = isRetryableError
+		retryPolicy = &ipfsRetryPolicy
+	}
+
+	var response []byte
+	err := retryPolicy.Do(ctx, func() error {
+		request, err := http.NewRequestWithContext(ctx, http.MethodPost, apiUrlFull, nil)
+		if err != nil {
+			logs.GetLogger().Error(err)
+			return err
+		}
+
+		response, err = web.GetDefaultClient().Do(request)
+		return err
+	})
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	return response, nil
+}
+
+//messages of the errors of commands which fail the same way when sent again
+var ipfsPermanentErrorMessages = []string{
+	"not pinned",
+	"invalid path",
+	"invalid cid",
+	"invalid ipfs path",
+	"no link named",
+	"failed to decode",
+	"unknown option",
+	"argument \"",
+}
+
+//ipfs answers the errors of commands with 500 as well as its own failures,
+//a 500 is retried unless its message is one of ipfsPermanentErrorMessages
+func isRetryableError(err error) bool {
+	var httpStatusError *web.HTTPStatusError
+	if errors.As(err, &httpStatusError) && httpStatusError.StatusCode == http.StatusInternalServerError {
+		message := strings.ToLower(httpStatusError.Message)
+		for _, permanentErrorMessage := range ipfsPermanentErrorMessages {
+			if strings.Contains(message, permanentErrorMessage) {
+				return false
+			}
+		}
+	}
+
+	return web.IsRetryableError(err)
+}
+
+//calls handle with each json value of a newline delimited response
+func decodeJsonValues(response []byte, handle func(value json.RawMessage) error) error {
+	decoder := json.NewDecoder(bytes.NewReader(response))
+	for {
+		var value json.RawMessage
+		err := decoder.Decode(&value)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			logs.GetLogger().Error(err)
+			return err
+		}
+
+		err = handle(value)
+		if err != nil {
+			logs.GetLogger().Error(err)
+			return err
+		}
+	}
+}
+
+//returns the pinned cids
+func (ipfsClient *IpfsClient) PinAdd(ctx context.Context, cid string, recursive bool) ([]string, error) {
+	query := url.Values{}
+	query.Set("arg", cid)
+	query.Set("recursive", strconv.FormatBool(recursive))
+	response, err := ipfsClient.call(ctx, "pin/add", query)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	pins := &struct {
+		Pins []string
+	}{}
+	err = json.Unmarshal(response, pins)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	return pins.Pins, nil
+}
+
+//returns the unpinned cids
+func (ipfsClient *IpfsClient) PinRm(ctx context.Context, cid string, recursive bool) ([]string, error) {
+	query := url.Values{}
+	query.Set("arg", cid)
+	query.Set("recursive", strconv.FormatBool(recursive))
+	response, err := ipfsClient.call(ctx, "pin/rm", query)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	pins := &struct {
+		Pins []string
+	}{}
+	err = json.Unmarshal(response, pins)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	return pins.Pins, nil
+}
+
+//lists all the pins of pinType when cid is empty, otherwise the pin of cid, which is an error when cid is not pinned,
+//empty pinType means IPFS_PIN_TYPE_ALL
+func (ipfsClient *IpfsClient) PinLs(ctx context.Context, cid, pinType string) ([]*IpfsPin, error) {
+	if pinType == "" {
+		pinType = IPFS_PIN_TYPE_ALL
+	}
+
+	query := url.Values{}
+	query.Set("type", pinType)
+	if cid != "" {
+		query.Set("arg", cid)
+	}
+
+	response, err := ipfsClient.call(ctx, "pin/ls", query)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	keys := &struct {
+		Keys map[string]struct {
+			Type string
+		}
+	}{}
+	err = json.Unmarshal(response, keys)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	ipfsPins := []*IpfsPin{}
+	for key, val := range keys.Keys {
+		ipfsPins = append(ipfsPins, &IpfsPin{Cid: key, Type: val.Type})
+	}
+
+	return ipfsPins, nil
+}
+
+func (ipfsClient *IpfsClient) IsPinned(ctx context.Context, cid string) (bool, error) {
+	ipfsPins, err := ipfsClient.PinLs(ctx, cid, IPFS_PIN_TYPE_ALL)
+	var httpStatusError *web.HTTPStatusError
+	if errors.As(err, &httpStatusError) && strings.Contains(httpStatusError.Message, IPFS_ERROR_NOT_PINNED) {
+		return false, nil
+	}
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return false, err
+	}
+
+	return len(ipfsPins) > 0, nil
+}
+
+//sets PinStatus of each car file to IPFS_PIN_STATUS_PINNED or IPFS_PIN_STATUS_UNPINNED according to its payload cid
+func (ipfsClient *IpfsClient) UpdateCarFilesPinStatus(ctx context.Context, carFiles []*model.CarFile) error {
+	for _, carFile := range carFiles {
+		pinned, err := ipfsClient.IsPinned(ctx, carFile.PayloadCid)
+		if err != nil {
+			logs.GetLogger().Error("payload cid:", carFile.PayloadCid, ", ", err)
+			return err
+		}
+
+		pinStatus := IPFS_PIN_STATUS_UNPINNED
+		if pinned {
+			pinStatus = IPFS_PIN_STATUS_PINNED
+		}
+		carFile.PinStatus = &pinStatus
+	}
+
+	return nil
+}
+
+//pins cid on a remote pinning service configured in the ipfs node, background means not to wait until it is pinned
+func (ipfsClient *IpfsClient) PinRemoteAdd(ctx context.Context, service, cid, name string, background bool) (*IpfsRemotePin, error) {
+	query := url.Values{}
+	query.Set("arg", cid)
+	query.Set("service", service)
+	query.Set("background", strconv.FormatBool(background))
+	if name != "" {
+		query.Set("name", name)
+	}
+
+	response, err := ipfsClient.call(ctx, "pin/remote/add", query)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	ipfsRemotePin := &IpfsRemotePin{}
+	err = json.Unmarshal(response, ipfsRemotePin)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	return ipfsRemotePin, nil
+}
+
+//empty cid and name match all, empty statuses means IPFS_REMOTE_PIN_STATUS_PINNED as ipfs does
+func (ipfsClient *IpfsClient) PinRemoteLs(ctx context.Context, service, cid, name string, statuses ...string) ([]*IpfsRemotePin, error) {
+	query := url.Values{}
+	query.Set("service", service)
+	if cid != "" {
+		query.Set("cid", cid)
+	}
+	if name != "" {
+		query.Set("name", name)
+	}
+	for _, status := range statuses {
+		query.Add("status", status)
+	}
+
+	response, err := ipfsClient.call(ctx, "pin/remote/ls", query)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	ipfsRemotePins := []*IpfsRemotePin{}
+	err = decodeJsonValues(response, func(value json.RawMessage) error {
+		ipfsRemotePin := &IpfsRemotePin{}
+		ipfsRemotePins = append(ipfsRemotePins, ipfsRemotePin)
+		return json.Unmarshal(value, ipfsRemotePin)
+	})
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	return ipfsRemotePins, nil
+}
+
+//removes the pins of cid on the remote pinning service, force is required when more than one pin matches
+func (ipfsClient *IpfsClient) PinRemoteRm(ctx context.Context, service, cid string, force bool) error {
+	query := url.Values{}
+	query.Set("service", service)
+	query.Set("cid", cid)
+	query.Set("force", strconv.FormatBool(force))
+	for _, status := range []string{IPFS_REMOTE_PIN_STATUS_QUEUED, IPFS_REMOTE_PIN_STATUS_PINNING, IPFS_REMOTE_PIN_STATUS_PINNED, IPFS_REMOTE_PIN_STATUS_FAILED} {
+		query.Add("status", status)
+	}
+
+	_, err := ipfsClient.call(ctx, "pin/remote/rm", query)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	return nil
+}
+
+func (ipfsClient *IpfsClient) PinRemoteServiceLs(ctx context.Context) ([]*IpfsRemotePinService, error) {
+	response, err := ipfsClient.call(ctx, "pin/remote/service/ls", url.Values{})
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	remoteServices := &struct {
+		RemoteServices []*IpfsRemotePinService
+	}{}
+	err = json.Unmarshal(response, remoteServices)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	return remoteServices.RemoteServices, nil
+}
+
+//total size of the blocks and their number
+func (ipfsClient *IpfsClient) DagStat(ctx context.Context, cid string) (*IpfsDagStat, error) {
+	query := url.Values{}
+	query.Set("arg", cid)
+	query.Set("progress", "false")
+	response, err := ipfsClient.call(ctx, "dag/stat", query)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	//newer ipfs returns the stats of each dag in DagStats
+	dagStat := &struct {
+		IpfsDagStat
+		DagStats []*IpfsDagStat
+	}{}
+	err = decodeJsonValues(response, func(value json.RawMessage) error {
+		return json.Unmarshal(value, dagStat)
+	})
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	if len(dagStat.DagStats) > 0 {
+		return dagStat.DagStats[0], nil
+	}
+
+	return &dagStat.IpfsDagStat, nil
+}
+
+func (ipfsClient *IpfsClient) BlockStat(ctx context.Context, cid string) (*IpfsBlockStat, error) {
+	query := url.Values{}
+	query.Set("arg", cid)
+	response, err := ipfsClient.call(ctx, "block/stat", query)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	ipfsBlockStat := &IpfsBlockStat{}
+	err = json.Unmarshal(response, ipfsBlockStat)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	return ipfsBlockStat, nil
+}
+
+//filesPath is an mfs path, or /ipfs/[cid]
+func (ipfsClient *IpfsClient) FilesStat(ctx context.Context, filesPath string) (*IpfsFilesStat, error) {
+	query := url.Values{}
+	query.Set("arg", filesPath)
+	response, err := ipfsClient.call(ctx, "files/stat", query)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	ipfsFilesStat := &IpfsFilesStat{}
+	err = json.Unmarshal(response, ipfsFilesStat)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	return ipfsFilesStat, nil
+}
+
+//copies the content of ipfsPath, which is a cid or a cid followed by a path, from the gateway to writer
+func (ipfsClient *IpfsClient) GatewayCat(ctx context.Context, ipfsPath string, writer io.Writer) (int64, error) {
+	if len(ipfsClient.GatewayUrl) == 0 {
+		err := fmt.Errorf("ipfs gateway url is required")
+		logs.GetLogger().Error(err)
+		return 0, err
+	}
+
+	gatewayUrlFull := utils.UrlJoin(ipfsClient.GatewayUrl, "ipfs", strings.TrimPrefix(ipfsPath, "/ipfs/"))
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, gatewayUrlFull, nil)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return 0, err
+	}
+
+	response, err := web.GetDefaultClient().HttpClient().Do(request)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return 0, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		message, _ := ioutil.ReadAll(io.LimitReader(response.Body, web.HTTP_ERROR_MESSAGE_MAX_LENGTH))
+		err := &web.HTTPStatusError{
+			StatusCode: response.StatusCode,
+			Status:     response.Status,
+			Url:        gatewayUrlFull,
+			Message:    strings.TrimSpace(string(message)),
+		}
+		logs.GetLogger().Error(err)
+		return 0, err
+	}
+
+	bytesWritten, err := io.Copy(writer, response.Body)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return bytesWritten, err
+	}
+
+	return bytesWritten, nil
+}
+
+//imports the blocks of a car file, the roots are pinned when pinRoots is true
+func (ipfsClient *IpfsClient) DagImport(ctx context.Context, carFilePath string, pinRoots bool) ([]*IpfsDagImportRoot, error) {
+	fileInfo, err := os.Stat(carFilePath)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	query := url.Values{}
+	query.Set("pin-roots", strconv.FormatBool(pinRoots))
+	apiUrlFull := utils.UrlJoin(ipfsClient.ApiUrl, "api/v0/dag/import") + "?" + query.Encode()
+
+	multipartOptions := &web.MultipartOptions{
+		Files: []*web.MultipartFile{
+			{
+				FieldName: IPFS_ADD_FIELD_NAME,
+				FileName:  url.QueryEscape(filepath.Base(carFilePath)),
+				Filepath:  carFilePath,
+				Size:      fileInfo.Size(),
+			},
+		},
+	}
+
+	response, err := web.GetDefaultClient().RequestMultipart(ctx, http.MethodPost, apiUrlFull, "", multipartOptions)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	ipfsDagImportRoots := []*IpfsDagImportRoot{}
+	err = decodeJsonValues(response, func(value json.RawMessage) error {
+		dagImportOutput := &struct {
+			Root *struct {
+				Cid struct {
+					Cid string `json:"/"`
+				}
+				PinErrorMsg string
+			}
+		}{}
+		err := json.Unmarshal(value, dagImportOutput)
+		if err != nil || dagImportOutput.Root == nil {
+			return err
+		}
+
+		ipfsDagImportRoots = append(ipfsDagImportRoots, &IpfsDagImportRoot{
+			Cid:         dagImportOutput.Root.Cid.Cid,
+			PinErrorMsg: dagImportOutput.Root.PinErrorMsg,
+		})
+		return nil
+	})
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	return ipfsDagImportRoots, nil
+}
@@ -1,7 +1,14 @@
 package ipfs
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
 
 	"github.com/filswan/go-swan-lib/client/web"
 	"github.com/filswan/go-swan-lib/constants"
@@ -9,39 +16,186 @@ import (
 	"github.com/filswan/go-swan-lib/utils"
 )
 
-func IpfsUploadFileByWebApi(apiUrl, filefullpath string) (*string, error) {
-	response, err := web.HttpUploadFileByStream(apiUrl, filefullpath)
+const (
+	IPFS_ADD_FIELD_NAME          = "file"
+	IPFS_ADD_RESPONSE_TYPE_ERROR = "error"
+)
+
+//an entry of the newline delimited json returned by api/v0/add, the root comes last
+type IpfsAddEntry struct {
+	Name string
+	Hash string
+	Size string // cumulative size of the dag
+}
+
+type IpfsAddOptions struct {
+	WrapWithDirectory bool
+	Pin               bool
+	CidVersion        int
+	RawLeaves         bool
+	Progress          web.ProgressFunc // called with the bytes uploaded and the total size of the files
+}
+
+func GetDefaultIpfsAddOptions() *IpfsAddOptions {
+	ipfsAddOptions := &IpfsAddOptions{
+		Pin: true,
+	}
+
+	return ipfsAddOptions
+}
+
+//apiUrl is the full url of api/v0/add with its query parameters,
+//returns the entries of all the files and directories added
+func IpfsUploadFileByWebApi(apiUrl, filefullpath string) ([]*IpfsAddEntry, error) {
+	multipartFiles, err := web.GetMultipartFiles(IPFS_ADD_FIELD_NAME, filefullpath)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	return ipfsAdd(context.Background(), apiUrl, multipartFiles, nil)
+}
+
+//adds files and directories, directories are added with everything under them like ipfs add -r
+func IpfsAdd(ctx context.Context, apiUrl string, srcPaths []string, ipfsAddOptions *IpfsAddOptions) ([]*IpfsAddEntry, error) {
+	if ipfsAddOptions == nil {
+		ipfsAddOptions = GetDefaultIpfsAddOptions()
+	}
+
+	multipartFiles := []*web.MultipartFile{}
+	for _, srcPath := range srcPaths {
+		srcMultipartFiles, err := web.GetMultipartFiles(IPFS_ADD_FIELD_NAME, srcPath)
+		if err != nil {
+			logs.GetLogger().Error(err)
+			return nil, err
+		}
+		multipartFiles = append(multipartFiles, srcMultipartFiles...)
+	}
+
+	query := url.Values{}
+	query.Set("stream-channels", "true")
+	query.Set("pin", strconv.FormatBool(ipfsAddOptions.Pin))
+	query.Set("wrap-with-directory", strconv.FormatBool(ipfsAddOptions.WrapWithDirectory))
+	query.Set("cid-version", strconv.Itoa(ipfsAddOptions.CidVersion))
+	query.Set("raw-leaves", strconv.FormatBool(ipfsAddOptions.RawLeaves))
+	apiUrlFull := utils.UrlJoin(apiUrl, "api/v0/add") + "?" + query.Encode()
+
+	return ipfsAdd(ctx, apiUrlFull, multipartFiles, ipfsAddOptions.Progress)
+}
+
+func ipfsAdd(ctx context.Context, apiUrlFull string, multipartFiles []*web.MultipartFile, progress web.ProgressFunc) ([]*IpfsAddEntry, error) {
+	//ipfs expects url encoded names, and the entries of a directory under its name
+	for _, multipartFile := range multipartFiles {
+		multipartFile.FileName = url.QueryEscape(multipartFile.FileName)
+	}
+
+	multipartOptions := &web.MultipartOptions{
+		Files:    multipartFiles,
+		Progress: progress,
+	}
+
+	response, err := web.GetDefaultClient().RequestMultipart(ctx, http.MethodPost, apiUrlFull, "", multipartOptions)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	ipfsAddEntries, err := parseIpfsAddResponse(response)
 	if err != nil {
 		logs.GetLogger().Error(err)
 		return nil, err
 	}
 
-	fileHash := utils.GetFieldStrFromJson(response, "Hash")
-	//logs.GetLogger().Info(carFileHash)
+	return ipfsAddEntries, nil
+}
+
+//progress entries, which have no hash, are skipped
+func parseIpfsAddResponse(response []byte) ([]*IpfsAddEntry, error) {
+	ipfsAddEntries := []*IpfsAddEntry{}
+	decoder := json.NewDecoder(bytes.NewReader(response))
+	for {
+		ipfsAddResponse := &struct {
+			IpfsAddEntry
+			Message string
+			Type    string
+		}{}
+		err := decoder.Decode(ipfsAddResponse)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			logs.GetLogger().Error(err)
+			return nil, err
+		}
+
+		if ipfsAddResponse.Type == IPFS_ADD_RESPONSE_TYPE_ERROR {
+			err := fmt.Errorf("ipfs add failed:%s", ipfsAddResponse.Message)
+			logs.GetLogger().Error(err)
+			return nil, err
+		}
+
+		if ipfsAddResponse.Hash == constants.EMPTY_STRING {
+			continue
+		}
 
-	if fileHash == constants.EMPTY_STRING {
+		ipfsAddEntry := ipfsAddResponse.IpfsAddEntry
+		ipfsAddEntries = append(ipfsAddEntries, &ipfsAddEntry)
+	}
+
+	if len(ipfsAddEntries) == 0 {
 		err := fmt.Errorf("cannot get file hash from response:%s", response)
-		//logs.GetLogger().Error(err)
+		logs.GetLogger().Error(err)
 		return nil, err
 	}
 
-	return &fileHash, nil
+	return ipfsAddEntries, nil
+}
+
+type ExportOptions struct {
+	Progress     web.ProgressFunc
+	ExpectedSize int64            // size of the car file, verified when greater than 0
+	Resume       bool             // continue from carFileFullPath.part left by a previous export
+	RetryPolicy  *web.RetryPolicy // nil means no retry, retried attempts continue from the partial file
 }
 
 func Export2CarFile(apiUrl, fileHash string, carFileFullPath string) error {
-	apiUrlFull := utils.UrlJoin(apiUrl, "api/v0/dag/export")
-	apiUrlFull = apiUrlFull + "?arg=" + fileHash + "&progress=false"
-	carFileContent, err := web.HttpPostNoToken(apiUrlFull, "")
+	bytesWritten, err := ExportCarFile(context.Background(), apiUrl, fileHash, carFileFullPath, nil)
 	if err != nil {
 		logs.GetLogger().Error(err)
 		return err
 	}
+	logs.GetLogger().Info(bytesWritten, " bytes have been written to:", carFileFullPath)
+	return nil
+}
+
+//streams the dag/export response to the car file, so that the car file is never held in memory
+func ExportCarFile(ctx context.Context, apiUrl, fileHash string, carFileFullPath string, exportOptions *ExportOptions) (int64, error) {
+	if exportOptions == nil {
+		exportOptions = &ExportOptions{}
+	}
+
+	apiUrlFull := utils.UrlJoin(apiUrl, "api/v0/dag/export")
+	apiUrlFull = apiUrlFull + "?arg=" + url.QueryEscape(fileHash) + "&progress=false"
+
+	client := web.GetDefaultClient()
+	if exportOptions.RetryPolicy != nil {
+		//dag/export is read only although it is sent by POST
+		retryPolicy := *exportOptions.RetryPolicy
+		retryPolicy.RetryNonIdempotent = true
+		client = client.WithRetryPolicy(&retryPolicy)
+	}
+
+	streamOptions := &web.StreamOptions{
+		Progress:     exportOptions.Progress,
+		ExpectedSize: exportOptions.ExpectedSize,
+		Resume:       exportOptions.Resume,
+	}
 
-	bytesWritten, err := utils.CreateFileWithByteContents(carFileFullPath, carFileContent)
+	bytesWritten, err := client.DownloadFile(ctx, http.MethodPost, apiUrlFull, "", "", carFileFullPath, streamOptions)
 	if err != nil {
 		logs.GetLogger().Error(err)
-		return err
+		return 0, err
 	}
-	logs.GetLogger().Info(bytesWritten, " bytes have been written to:", carFileFullPath)
-	return nil
+
+	return bytesWritten, nil
 }
@@ -0,0 +1,193 @@
+package ipfs
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+
+	"github.com/filswan/go-swan-lib/logs"
+
+	"github.com/filecoin-project/go-dagaggregator-unixfs"
+	"github.com/ipfs/go-cid"
+)
+
+var ErrDagNotInAggregate = errors.New("dag not in aggregate")
+
+var manifestCsvHeader = []string{"dag_cid_v1", "dag_cid_v0", "dag_size", "node_count", "path"}
+
+//path of the dag inside the aggregate dag, relative to its root
+func GetManifestEntryPath(manifestEntry *dagaggregator.ManifestDagEntry) string {
+	return path.Join(manifestEntry.PathPrefixes[0], manifestEntry.PathPrefixes[1], manifestEntry.DagCidV1)
+}
+
+//newline delimited json, the same as the manifest file at the root of the aggregate dag
+func WriteManifestJson(manifestEntries []*dagaggregator.ManifestDagEntry, writer io.Writer) error {
+	err := dagaggregator.EncodeManifestJSON(manifestEntries, writer)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	return nil
+}
+
+//one line per dag after the header line, dag_size and node_count are empty when unknown
+func WriteManifestCsv(manifestEntries []*dagaggregator.ManifestDagEntry, writer io.Writer) error {
+	csvWriter := csv.NewWriter(writer)
+	err := csvWriter.Write(manifestCsvHeader)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	for _, manifestEntry := range manifestEntries {
+		dagSize := ""
+		if manifestEntry.DagSize != nil {
+			dagSize = strconv.FormatUint(*manifestEntry.DagSize, 10)
+		}
+
+		nodeCount := ""
+		if manifestEntry.NodeCount != nil {
+			nodeCount = strconv.FormatUint(*manifestEntry.NodeCount, 10)
+		}
+
+		err := csvWriter.Write([]string{manifestEntry.DagCidV1, manifestEntry.DagCidV0, dagSize, nodeCount, GetManifestEntryPath(manifestEntry)})
+		if err != nil {
+			logs.GetLogger().Error(err)
+			return err
+		}
+	}
+
+	csvWriter.Flush()
+	err = csvWriter.Error()
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	return nil
+}
+
+func SaveManifestJson(manifestEntries []*dagaggregator.ManifestDagEntry, jsonFilepath string) error {
+	return saveManifest(manifestEntries, jsonFilepath, WriteManifestJson)
+}
+
+func SaveManifestCsv(manifestEntries []*dagaggregator.ManifestDagEntry, csvFilepath string) error {
+	return saveManifest(manifestEntries, csvFilepath, WriteManifestCsv)
+}
+
+func saveManifest(manifestEntries []*dagaggregator.ManifestDagEntry, filepath string, write func([]*dagaggregator.ManifestDagEntry, io.Writer) error) error {
+	file, err := os.Create(filepath)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	writer := bufio.NewWriter(file)
+	err = write(manifestEntries, writer)
+	if err == nil {
+		err = writer.Flush()
+	}
+	if err != nil {
+		logs.GetLogger().Error(err)
+		file.Close()
+		return err
+	}
+
+	err = file.Close()
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	return nil
+}
+
+//reads the dag entries of a manifest written by WriteManifestJson, the preamble and the summary are skipped
+func ReadManifestJson(reader io.Reader) ([]*dagaggregator.ManifestDagEntry, error) {
+	manifestEntries := []*dagaggregator.ManifestDagEntry{}
+	decoder := json.NewDecoder(reader)
+	for {
+		manifestEntry := &dagaggregator.ManifestDagEntry{}
+		err := decoder.Decode(manifestEntry)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			logs.GetLogger().Error(err)
+			return nil, err
+		}
+
+		if manifestEntry.RecordType == dagaggregator.DagAggregateEntry {
+			manifestEntries = append(manifestEntries, manifestEntry)
+		}
+	}
+
+	return manifestEntries, nil
+}
+
+//returns the entry of dagCid, which can be cid v0 or v1
+func FindManifestEntry(manifestEntries []*dagaggregator.ManifestDagEntry, dagCid string) (*dagaggregator.ManifestDagEntry, error) {
+	c, err := cid.Decode(dagCid)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	//the aggregate names the dags by their cid v1
+	dagCidV1 := cid.NewCidV1(c.Type(), c.Hash()).String()
+	for _, manifestEntry := range manifestEntries {
+		if manifestEntry.DagCidV1 == dagCidV1 {
+			return manifestEntry, nil
+		}
+	}
+
+	err = fmt.Errorf("dag cid:%s, %w", dagCid, ErrDagNotInAggregate)
+	logs.GetLogger().Error(err)
+	return nil, err
+}
+
+//reads the manifest file at the root of the aggregate dag
+func (ipfsClient *IpfsClient) GetAggregateManifest(ctx context.Context, aggregateRoot string) ([]*dagaggregator.ManifestDagEntry, error) {
+	query := url.Values{}
+	query.Set("arg", path.Join("/ipfs", aggregateRoot, dagaggregator.AggregateManifestFilename))
+	response, err := ipfsClient.call(ctx, "cat", query)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	manifestEntries, err := ReadManifestJson(bytes.NewReader(response))
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	return manifestEntries, nil
+}
+
+//returns /ipfs/[aggregateRoot]/[path of dagCid inside the aggregate]
+func (ipfsClient *IpfsClient) LookupAggregatePath(ctx context.Context, aggregateRoot, dagCid string) (string, error) {
+	manifestEntries, err := ipfsClient.GetAggregateManifest(ctx, aggregateRoot)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return "", err
+	}
+
+	manifestEntry, err := FindManifestEntry(manifestEntries, dagCid)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return "", err
+	}
+
+	return path.Join("/ipfs", aggregateRoot, GetManifestEntryPath(manifestEntry)), nil
+}
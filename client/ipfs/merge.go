@@ -1,17 +1,14 @@
 package ipfs
 
 import (
-	"bufio"
 	"context"
-	"fmt"
-	"os"
-	"os/signal"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/filecoin-project/go-dagaggregator-unixfs"
 	"github.com/filecoin-project/go-dagaggregator-unixfs/lib/rambs"
+	"github.com/filswan/go-swan-lib/client/web"
 	"github.com/filswan/go-swan-lib/logs"
 	"github.com/ipfs/go-blockservice"
 	"github.com/ipfs/go-cid"
@@ -20,41 +17,76 @@ import (
 	exchangeoffline "github.com/ipfs/go-ipfs-exchange-offline"
 	ipfsfiles "github.com/ipfs/go-ipfs-files"
 	"github.com/ipfs/go-merkledag"
-	"github.com/mattn/go-isatty"
 	"github.com/multiformats/go-multihash"
-	"golang.org/x/sys/unix"
 	"golang.org/x/xerrors"
 )
 
-type opts struct {
-	IpfsAPI            string `getopt:"--ipfs-api             A read/write IPFS API URL"`
-	IpfsAPIMaxWorkers  uint   `getopt:"--ipfs-api-max-workers Max amount of parallel API requests"`
-	IpfsAPITimeoutSecs uint   `getopt:"--ipfs-api-timeout     Max amount of seconds for a single API operation"`
-	ShowProgress       bool   `getopt:"--show-progress        Print progress on STDERR, default when a TTY"`
+const (
+	MERGE_WORKERS_DEFAULT        = 8
+	MERGE_TIMEOUT_SECOND_DEFAULT = 300
+	MERGE_PROGRESS_INTERVAL      = 250 * time.Millisecond
+
+	MERGE_STAGE_STAT_SOURCES = "stat sources"
+	MERGE_STAGE_WRITE_BLOCKS = "write blocks"
+)
+
+// called from a single goroutine while a stage is running and once when it is complete
+type MergeProgressFunc func(stage string, done, total uint64)
+
+type MergeOptions struct {
+	Workers       uint              // parallel api requests
+	TimeoutSecond uint              // of a single api request
+	Progress      MergeProgressFunc // optional
+	RetryPolicy   *web.RetryPolicy  // nil means no retry
+	SkipDagStat   bool              // do not query the size and block count of the sources, the links of the aggregate then have no size
+
+	ManifestJsonPath string // when set, the manifest is saved there as newline delimited json, see SaveManifestJson
+	ManifestCsvPath  string // when set, the manifest is saved there as csv, see SaveManifestCsv
+}
+
+type SourceDagStat struct {
+	Cid       string
+	Size      uint64 // 0 when the dag stat is skipped
+	NumBlocks uint64
+}
+
+type MergeResult struct {
+	Root                  string // root cid of the aggregate dag
+	ManifestEntries       []*dagaggregator.ManifestDagEntry
+	SourceDagStats        []*SourceDagStat // in the order of the source cids, duplicates removed
+	NewIntermediateBlocks int              // blocks created for the aggregate and written to ipfs
+}
+
+func GetDefaultMergeOptions() *MergeOptions {
+	mergeOptions := &MergeOptions{
+		Workers:       MERGE_WORKERS_DEFAULT,
+		TimeoutSecond: MERGE_TIMEOUT_SECOND_DEFAULT,
+		RetryPolicy:   web.DefaultRetryPolicy(),
+	}
+
+	return mergeOptions
 }
 
+// aggregates the dags with default options, see MergeFiles
 func MergeFiles2CarFile(apiUrl string, cidStrs []string) (*string, error) {
-	opts := &opts{
-		ShowProgress:       isatty.IsTerminal(os.Stderr.Fd()),
-		IpfsAPIMaxWorkers:  8,
-		IpfsAPITimeoutSecs: 300,
-		IpfsAPI:            apiUrl,
+	mergeResult, err := MergeFiles(context.Background(), apiUrl, cidStrs, nil)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
 	}
 
-	ctx, cancel := context.WithCancel(context.Background())
-	go func() {
-		sigs := make(chan os.Signal, 1)
-		signal.Notify(sigs, unix.SIGINT, unix.SIGTERM, unix.SIGHUP)
-		<-sigs
-		cancel()
-	}()
-
-	if len(cidStrs) == 0 {
-		s := bufio.NewScanner(os.Stdin)
-		s.Split(bufio.ScanWords)
-		for s.Scan() {
-			cidStrs = append(cidStrs, s.Text())
-		}
+	return &mergeResult.Root, nil
+}
+
+// aggregates the dags of cidStrs into a unixfs directory whose intermediate blocks are written to ipfs,
+// nil mergeOptions means GetDefaultMergeOptions()
+func MergeFiles(ctx context.Context, apiUrl string, cidStrs []string, mergeOptions *MergeOptions) (*MergeResult, error) {
+	if mergeOptions == nil {
+		mergeOptions = GetDefaultMergeOptions()
+	}
+
+	if mergeOptions.Workers == 0 {
+		mergeOptions.Workers = MERGE_WORKERS_DEFAULT
 	}
 
 	cset := cid.NewSet()
@@ -62,7 +94,7 @@ func MergeFiles2CarFile(apiUrl string, cidStrs []string) (*string, error) {
 	for _, cs := range cidStrs {
 		c, err := cid.Parse(cs)
 		if err != nil {
-			logs.GetLogger().Error("unable to parse '%s': %s", cs, err)
+			logs.GetLogger().Errorf("unable to parse '%s': %s", cs, err)
 			return nil, err
 		}
 		if cset.Visit(c) {
@@ -70,26 +102,60 @@ func MergeFiles2CarFile(apiUrl string, cidStrs []string) (*string, error) {
 		}
 	}
 
+	if !mergeOptions.SkipDagStat {
+		if err := statSources(ctx, apiUrl, mergeOptions, toAgg); err != nil {
+			logs.GetLogger().Errorf("getting dag stats of the sources failed: %s", err)
+			return nil, err
+		}
+	}
+
 	ramBs := new(rambs.RamBs)
 	ramDs := merkledag.NewDAGService(blockservice.New(ramBs, exchangeoffline.Exchange(ramBs)))
 	root, entries, err := dagaggregator.Aggregate(ctx, ramDs, toAgg)
 	if err != nil {
-		logs.GetLogger().Error("aggregation failed: %s", err)
+		logs.GetLogger().Errorf("aggregation failed: %s", err)
 		return nil, err
 	}
 
-	if err := writeoutBlocks(ctx, opts, ramBs); err != nil {
-		logs.GetLogger().Error("writing newly created dag to IPFS API failed: %s", err)
+	if err := writeoutBlocks(ctx, apiUrl, mergeOptions, ramBs); err != nil {
+		logs.GetLogger().Errorf("writing newly created dag to IPFS API failed: %s", err)
 		return nil, err
 	}
 
 	akc, _ := ramBs.AllKeysChan(ctx)
-	dataCid := root.String()
-	logs.GetLogger().Info("aggregation finished, aggregateRoot: ", root, ", data cid:", dataCid, ", totalManifestEntries: ", len(entries), ", newIntermediateBlocks: ", len(akc))
-	return &dataCid, nil
+	mergeResult := &MergeResult{
+		Root:                  root.String(),
+		ManifestEntries:       entries,
+		NewIntermediateBlocks: len(akc),
+	}
+
+	for _, aggregateDagEntry := range toAgg {
+		mergeResult.SourceDagStats = append(mergeResult.SourceDagStats, &SourceDagStat{
+			Cid:       aggregateDagEntry.RootCid.String(),
+			Size:      aggregateDagEntry.UniqueBlockCumulativeSize,
+			NumBlocks: aggregateDagEntry.UniqueBlockCount,
+		})
+	}
+
+	if mergeOptions.ManifestJsonPath != "" {
+		if err := SaveManifestJson(entries, mergeOptions.ManifestJsonPath); err != nil {
+			logs.GetLogger().Errorf("saving the manifest as json failed: %s", err)
+			return nil, err
+		}
+	}
+
+	if mergeOptions.ManifestCsvPath != "" {
+		if err := SaveManifestCsv(entries, mergeOptions.ManifestCsvPath); err != nil {
+			logs.GetLogger().Errorf("saving the manifest as csv failed: %s", err)
+			return nil, err
+		}
+	}
+
+	logs.GetLogger().Info("aggregation finished, aggregateRoot: ", root, ", totalManifestEntries: ", len(entries), ", newIntermediateBlocks: ", len(akc))
+	return mergeResult, nil
 }
 
-func statSources(externalCtx context.Context, opts *opts, toAgg []dagaggregator.AggregateDagEntry) error {
+func statSources(externalCtx context.Context, apiUrl string, mergeOptions *MergeOptions, toAgg []dagaggregator.AggregateDagEntry) error {
 
 	type dagStat struct {
 		Size      uint64
@@ -109,7 +175,7 @@ func statSources(externalCtx context.Context, opts *opts, toAgg []dagaggregator.
 	close(workCh)
 
 	finishCh := make(chan struct{}, 1)
-	maxWorkers := opts.IpfsAPIMaxWorkers
+	maxWorkers := mergeOptions.Workers
 	errCh := make(chan error, maxWorkers)
 
 	var wg sync.WaitGroup
@@ -119,8 +185,8 @@ func statSources(externalCtx context.Context, opts *opts, toAgg []dagaggregator.
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			api := ipfsapi.NewShell(opts.IpfsAPI)
-			api.SetTimeout(time.Second * time.Duration(opts.IpfsAPITimeoutSecs))
+			api := ipfsapi.NewShell(apiUrl)
+			api.SetTimeout(time.Second * time.Duration(mergeOptions.TimeoutSecond))
 
 			for {
 				toAggIdx, chanOpen := <-workCh
@@ -134,7 +200,9 @@ func statSources(externalCtx context.Context, opts *opts, toAgg []dagaggregator.
 				}
 
 				ds := new(dagStat)
-				err := api.Request("dag/stat").Arguments(toAgg[toAggIdx].RootCid.String()).Option("progress", "false").Exec(innerCtx, ds)
+				err := mergeOptions.RetryPolicy.Do(innerCtx, func() error {
+					return api.Request("dag/stat").Arguments(toAgg[toAggIdx].RootCid.String()).Option("progress", "false").Exec(innerCtx, ds)
+				})
 				if err != nil {
 					errCh <- err
 					return
@@ -143,19 +211,17 @@ func statSources(externalCtx context.Context, opts *opts, toAgg []dagaggregator.
 				toAgg[toAggIdx].UniqueBlockCount = ds.NumBlocks
 				toAgg[toAggIdx].UniqueBlockCumulativeSize = ds.Size
 
-				if opts.ShowProgress {
-					atomic.AddUint64(dagsDone, 1)
-				}
+				atomic.AddUint64(dagsDone, 1)
 			}
 		}()
 	}
 
-	var lastPct uint64
+	var lastDone uint64
 	dagsTotal := uint64(len(toAgg))
 	var progressTick <-chan time.Time
-	if opts.ShowProgress {
-		fmt.Fprint(os.Stderr, "0% of dags analyzed\r")
-		t := time.NewTicker(250 * time.Millisecond)
+	if mergeOptions.Progress != nil {
+		mergeOptions.Progress(MERGE_STAGE_STAT_SOURCES, 0, dagsTotal)
+		t := time.NewTicker(MERGE_PROGRESS_INTERVAL)
 		progressTick = t.C
 		defer t.Stop()
 	}
@@ -176,15 +242,18 @@ watchdog:
 			break watchdog
 
 		case <-progressTick:
-			curPct := 100 * atomic.LoadUint64(dagsDone) / dagsTotal
-			if curPct != lastPct {
-				lastPct = curPct
-				fmt.Fprintf(os.Stderr, "%d%% of dags analyzed\r", lastPct)
+			curDone := atomic.LoadUint64(dagsDone)
+			if curDone != lastDone {
+				lastDone = curDone
+				mergeOptions.Progress(MERGE_STAGE_STAT_SOURCES, lastDone, dagsTotal)
 			}
 		}
 	}
 
 	wg.Wait()
+	if mergeOptions.Progress != nil {
+		mergeOptions.Progress(MERGE_STAGE_STAT_SOURCES, atomic.LoadUint64(dagsDone), dagsTotal)
+	}
 	close(errCh) // closing a buffered channel keeps any buffered values for <-
 
 	if workerError != nil {
@@ -197,7 +266,7 @@ watchdog:
 }
 
 // pulls cids from an AllKeysChan and sends them concurrently via multiple workers to an API
-func writeoutBlocks(externalCtx context.Context, opts *opts, bs blockstore.Blockstore) error {
+func writeoutBlocks(externalCtx context.Context, apiUrl string, mergeOptions *MergeOptions, bs blockstore.Blockstore) error {
 
 	innerCtx, shutdownWorkers := context.WithCancel(externalCtx)
 	defer shutdownWorkers()
@@ -207,7 +276,7 @@ func writeoutBlocks(externalCtx context.Context, opts *opts, bs blockstore.Block
 		return err
 	}
 
-	maxWorkers := opts.IpfsAPIMaxWorkers
+	maxWorkers := mergeOptions.Workers
 	finishCh := make(chan struct{}, 1)
 	errCh := make(chan error, maxWorkers)
 
@@ -220,8 +289,8 @@ func writeoutBlocks(externalCtx context.Context, opts *opts, bs blockstore.Block
 		go func() {
 			defer wg.Done()
 
-			api := ipfsapi.NewShell(opts.IpfsAPI)
-			api.SetTimeout(time.Second * time.Duration(opts.IpfsAPITimeoutSecs))
+			api := ipfsapi.NewShell(apiUrl)
+			api.SetTimeout(time.Second * time.Duration(mergeOptions.TimeoutSecond))
 
 			for {
 				select {
@@ -249,22 +318,24 @@ func writeoutBlocks(externalCtx context.Context, opts *opts, bs blockstore.Block
 
 					// copied entirety of ipfsapi.BlockPut() to be able to pass in our own ctx 🤮
 					res := new(struct{ Key string })
-					err = api.Request("block/put").
-						Option("format", cid.CodecToStr[c.Prefix().Codec]).
-						Option("mhtype", multihash.Codes[c.Prefix().MhType]).
-						Option("mhlen", c.Prefix().MhLength).
-						Body(
-							ipfsfiles.NewMultiFileReader(
-								ipfsfiles.NewSliceDirectory([]ipfsfiles.DirEntry{
-									ipfsfiles.FileEntry(
-										"",
-										ipfsfiles.NewBytesFile(blk.RawData()),
-									),
-								}),
-								true,
-							),
-						).
-						Exec(innerCtx, res)
+					err = mergeOptions.RetryPolicy.Do(innerCtx, func() error {
+						return api.Request("block/put").
+							Option("format", cid.CodecToStr[c.Prefix().Codec]).
+							Option("mhtype", multihash.Codes[c.Prefix().MhType]).
+							Option("mhlen", c.Prefix().MhLength).
+							Body(
+								ipfsfiles.NewMultiFileReader(
+									ipfsfiles.NewSliceDirectory([]ipfsfiles.DirEntry{
+										ipfsfiles.FileEntry(
+											"",
+											ipfsfiles.NewBytesFile(blk.RawData()),
+										),
+									}),
+									true,
+								),
+							).
+							Exec(innerCtx, res)
+					})
 					// end of 🤮
 
 					if err != nil {
@@ -277,21 +348,19 @@ func writeoutBlocks(externalCtx context.Context, opts *opts, bs blockstore.Block
 						return
 					}
 
-					if opts.ShowProgress {
-						atomic.AddUint64(blocksDone, 1)
-					}
+					atomic.AddUint64(blocksDone, 1)
 				}
 			}
 		}()
 	}
 
-	var blocksTotal, lastPct uint64
+	// this works because of how AllKeysChan behaves on rambs
+	blocksTotal := uint64(len(akc))
+	var lastDone uint64
 	var progressTick <-chan time.Time
-	if opts.ShowProgress {
-		// this works because of how AllKeysChan behaves on rambs
-		blocksTotal = uint64(len(akc))
-		fmt.Fprint(os.Stderr, "0% of blocks written\r")
-		t := time.NewTicker(250 * time.Millisecond)
+	if mergeOptions.Progress != nil {
+		mergeOptions.Progress(MERGE_STAGE_WRITE_BLOCKS, 0, blocksTotal)
+		t := time.NewTicker(MERGE_PROGRESS_INTERVAL)
 		progressTick = t.C
 		defer t.Stop()
 	}
@@ -312,15 +381,18 @@ watchdog:
 			break watchdog
 
 		case <-progressTick:
-			curPct := 100 * atomic.LoadUint64(blocksDone) / blocksTotal
-			if curPct != lastPct {
-				lastPct = curPct
-				fmt.Fprintf(os.Stderr, "%d%% of blocks written\r", lastPct)
+			curDone := atomic.LoadUint64(blocksDone)
+			if curDone != lastDone {
+				lastDone = curDone
+				mergeOptions.Progress(MERGE_STAGE_WRITE_BLOCKS, lastDone, blocksTotal)
 			}
 		}
 	}
 
 	wg.Wait()
+	if mergeOptions.Progress != nil {
+		mergeOptions.Progress(MERGE_STAGE_WRITE_BLOCKS, atomic.LoadUint64(blocksDone), blocksTotal)
+	}
 	close(errCh) // closing a buffered channel keeps any buffered values for <-
 
 	if workerError != nil {
@@ -1,10 +1,9 @@
 package lotus
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
 
-	"github.com/filswan/go-swan-lib/client/web"
 	"github.com/filswan/go-swan-lib/logs"
 )
 
@@ -44,35 +43,12 @@ func LotusAuthVerify(apiUrl, token string) ([]string, error) {
 		return nil, err
 	}
 
-	var params []interface{}
-	params = append(params, token)
-
-	jsonRpcParams := LotusJsonRpcParams{
-		JsonRpc: LOTUS_JSON_RPC_VERSION,
-		Method:  FILECOIN_AUTH_VERIFY,
-		Params:  params,
-		Id:      LOTUS_JSON_RPC_ID,
-	}
-
-	//here the api url should be miner's api url, need to change later on
-	response, err := web.HttpGetNoToken(apiUrl, jsonRpcParams)
-	if err != nil {
-		logs.GetLogger().Error(err)
-		return nil, err
-	}
-
 	authVerify := &AuthVerify{}
-	err = json.Unmarshal(response, authVerify)
+	err := GetRPC(apiUrl, "", nil).Call(context.Background(), FILECOIN_AUTH_VERIFY, &authVerify.Result, token)
 	if err != nil {
 		logs.GetLogger().Error(err)
 		return nil, err
 	}
 
-	if authVerify.Error != nil {
-		err := fmt.Errorf("error, code:%d, message:%s", authVerify.Error.Code, authVerify.Error.Message)
-		logs.GetLogger().Error(err)
-		return nil, err
-	}
-
 	return authVerify.Result, nil
 }
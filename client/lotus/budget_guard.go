@@ -0,0 +1,98 @@
+package lotus
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/filswan/go-swan-lib/logs"
+
+	"github.com/shopspring/decimal"
+)
+
+var ErrBudgetExceeded = errors.New("wallet budget exceeded")
+
+//keeps the total cost of deals sent from each wallet under a ceiling in FIL,
+//costs are reserved before deals are sent and released for deals not sent,
+//a BudgetGuard built as a struct literal works as one from GetBudgetGuard
+type BudgetGuard struct {
+	MaxCost         decimal.Decimal            // ceiling for wallets not in MaxCostByWallet
+	MaxCostByWallet map[string]decimal.Decimal // ceilings of specific wallets
+
+	mutex    sync.Mutex
+	reserved map[string]decimal.Decimal
+}
+
+func GetBudgetGuard(maxCost decimal.Decimal) *BudgetGuard {
+	budgetGuard := &BudgetGuard{
+		MaxCost:         maxCost,
+		MaxCostByWallet: map[string]decimal.Decimal{},
+		reserved:        map[string]decimal.Decimal{},
+	}
+
+	return budgetGuard
+}
+
+func (budgetGuard *BudgetGuard) getMaxCost(wallet string) decimal.Decimal {
+	maxCost, ok := budgetGuard.MaxCostByWallet[wallet]
+	if !ok {
+		return budgetGuard.MaxCost
+	}
+
+	return maxCost
+}
+
+//total cost already reserved for the wallet
+func (budgetGuard *BudgetGuard) Reserved(wallet string) decimal.Decimal {
+	budgetGuard.mutex.Lock()
+	defer budgetGuard.mutex.Unlock()
+
+	return budgetGuard.reserved[wallet]
+}
+
+//reserves the total cost of all the deals, nothing is reserved when any wallet would exceed its ceiling
+func (budgetGuard *BudgetGuard) Reserve(dealSummaries []*DealSummary) error {
+	costs := map[string]decimal.Decimal{}
+	for _, dealSummary := range dealSummaries {
+		costs[dealSummary.Wallet] = costs[dealSummary.Wallet].Add(dealSummary.TotalCost)
+	}
+
+	budgetGuard.mutex.Lock()
+	defer budgetGuard.mutex.Unlock()
+
+	for wallet, cost := range costs {
+		maxCost := budgetGuard.getMaxCost(wallet)
+		total := budgetGuard.reserved[wallet].Add(cost)
+		if total.GreaterThan(maxCost) {
+			err := fmt.Errorf("wallet:%s, cost:%s FIL, reserved:%s FIL, max cost:%s FIL, %w", wallet, cost, budgetGuard.reserved[wallet], maxCost, ErrBudgetExceeded)
+			logs.GetLogger().Error(err)
+			return err
+		}
+	}
+
+	if budgetGuard.reserved == nil {
+		budgetGuard.reserved = map[string]decimal.Decimal{}
+	}
+
+	for wallet, cost := range costs {
+		budgetGuard.reserved[wallet] = budgetGuard.reserved[wallet].Add(cost)
+	}
+
+	return nil
+}
+
+//gives back the cost of a deal which is not sent
+func (budgetGuard *BudgetGuard) Release(dealSummary *DealSummary) {
+	budgetGuard.mutex.Lock()
+	defer budgetGuard.mutex.Unlock()
+
+	if budgetGuard.reserved == nil {
+		budgetGuard.reserved = map[string]decimal.Decimal{}
+	}
+
+	reserved := budgetGuard.reserved[dealSummary.Wallet].Sub(dealSummary.TotalCost)
+	if reserved.IsNegative() {
+		reserved = decimal.Zero
+	}
+	budgetGuard.reserved[dealSummary.Wallet] = reserved
+}
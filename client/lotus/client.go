@@ -1,11 +1,10 @@
 package lotus
 
 import (
-	"bufio"
-	"encoding/json"
+	"context"
 	"fmt"
-	"os"
 	"strings"
+	"time"
 
 	"github.com/filswan/go-swan-lib/client/web"
 	"github.com/filswan/go-swan-lib/constants"
@@ -37,6 +36,9 @@ const (
 type LotusClient struct {
 	ApiUrl      string
 	AccessToken string
+	RetryPolicy *web.RetryPolicy // nil means no retry, deal proposals are never retried
+	Transport   RpcCaller        // nil means json-rpc over http, set a WsRPC to share a websocket connection
+	Confirmer   Confirmer        // asked before LotusClientStartDeal sends a deal, nil means StdinConfirmer
 }
 
 type ClientCalcCommP struct {
@@ -65,6 +67,7 @@ func LotusGetClient(apiUrl, accessToken string) (*LotusClient, error) {
 	lotusClient := &LotusClient{
 		ApiUrl:      apiUrl,
 		AccessToken: accessToken,
+		RetryPolicy: getRpcRetryPolicy(),
 	}
 
 	return lotusClient, nil
@@ -116,32 +119,10 @@ type ClientDealCostStatus struct {
 }
 
 func (lotusClient *LotusClient) LotusClientGetDealInfo(dealCid string) (*ClientDealCostStatus, error) {
-	var params []interface{}
-	cid := Cid{Cid: dealCid}
-	params = append(params, cid)
-
-	jsonRpcParams := LotusJsonRpcParams{
-		JsonRpc: LOTUS_JSON_RPC_VERSION,
-		Method:  LOTUS_CLIENT_GET_DEAL_INFO,
-		Params:  params,
-		Id:      LOTUS_JSON_RPC_ID,
-	}
-
-	response, err := web.HttpGetNoToken(lotusClient.ApiUrl, jsonRpcParams)
-	if err != nil {
-		logs.GetLogger().Error(err)
-		return nil, err
-	}
-
 	clientDealInfo := &ClientDealInfo{}
-	err = json.Unmarshal(response, clientDealInfo)
+	err := lotusClient.getRpc().Call(context.Background(), LOTUS_CLIENT_GET_DEAL_INFO, &clientDealInfo.Result, Cid{Cid: dealCid})
 	if err != nil {
-		logs.GetLogger().Error(err)
-		return nil, err
-	}
-
-	if clientDealInfo.Error != nil {
-		err := fmt.Errorf("deal:%s,code:%d,message:%s", dealCid, clientDealInfo.Error.Code, clientDealInfo.Error.Message)
+		err := fmt.Errorf("deal:%s,%w", dealCid, err)
 		logs.GetLogger().Error(err)
 		return nil, err
 	}
@@ -204,35 +185,17 @@ func GetDealCost(dealCost ClientDealCostStatus) string {
 }
 
 func (lotusClient *LotusClient) LotusClientMinerQuery(minerFid string) (*string, error) {
-	var params []interface{}
-	params = append(params, minerFid)
-	params = append(params, nil)
-	params = append(params, nil)
+	return lotusClient.minerQuery(context.Background(), minerFid)
+}
 
-	jsonRpcParams := LotusJsonRpcParams{
-		JsonRpc: LOTUS_JSON_RPC_VERSION,
-		Method:  LOTUS_CLIENT_MINER_QUERY,
-		Params:  params,
-		Id:      LOTUS_JSON_RPC_ID,
-	}
-
-	timeOutSecond := constants.HTTP_API_TIMEOUT_SECOND
-	response, err := web.HttpGetNoTokenTimeout(lotusClient.ApiUrl, jsonRpcParams, &timeOutSecond)
-	if err != nil {
-		logs.GetLogger().Error(err)
-		return nil, err
-	}
+func (lotusClient *LotusClient) minerQuery(ctx context.Context, minerFid string) (*string, error) {
+	ctx, cancel := context.WithTimeout(ctx, constants.HTTP_API_TIMEOUT_SECOND*time.Second)
+	defer cancel()
 
 	clientMinerQuery := &ClientMinerQuery{}
-	err = json.Unmarshal(response, clientMinerQuery)
+	err := lotusClient.getRpc().Call(ctx, LOTUS_CLIENT_MINER_QUERY, &clientMinerQuery.Result, minerFid, nil, nil)
 	if err != nil {
-		err := fmt.Errorf("miner:%s,%s", minerFid, err.Error())
-		logs.GetLogger().Error(err)
-		return nil, err
-	}
-
-	if clientMinerQuery.Error != nil {
-		err := fmt.Errorf("miner:%s,code:%d,message:%s", minerFid, clientMinerQuery.Error.Code, clientMinerQuery.Error.Message)
+		err := fmt.Errorf("miner:%s,%w", minerFid, err)
 		logs.GetLogger().Error(err)
 		return nil, err
 	}
@@ -259,39 +222,23 @@ type MinerConfig struct {
 }
 
 func (lotusClient *LotusClient) LotusClientQueryAsk(minerFid string) (*MinerConfig, error) {
-	minerPeerId, err := lotusClient.LotusClientMinerQuery(minerFid)
-	if err != nil {
-		logs.GetLogger().Error(err)
-		return nil, err
-	}
-
-	var params []interface{}
-	params = append(params, minerPeerId)
-	params = append(params, minerFid)
-
-	jsonRpcParams := LotusJsonRpcParams{
-		JsonRpc: LOTUS_JSON_RPC_VERSION,
-		Method:  LOTUS_CLIENT_QUERY_ASK,
-		Params:  params,
-		Id:      LOTUS_JSON_RPC_ID,
-	}
+	return lotusClient.queryAsk(context.Background(), minerFid)
+}
 
-	timeOutSecond := constants.HTTP_API_TIMEOUT_SECOND
-	response, err := web.HttpGetNoTokenTimeout(lotusClient.ApiUrl, jsonRpcParams, &timeOutSecond)
+func (lotusClient *LotusClient) queryAsk(ctx context.Context, minerFid string) (*MinerConfig, error) {
+	minerPeerId, err := lotusClient.minerQuery(ctx, minerFid)
 	if err != nil {
 		logs.GetLogger().Error(err)
 		return nil, err
 	}
 
+	ctx, cancel := context.WithTimeout(ctx, constants.HTTP_API_TIMEOUT_SECOND*time.Second)
+	defer cancel()
+
 	clientQueryAsk := &ClientQueryAsk{}
-	err = json.Unmarshal(response, clientQueryAsk)
+	err = lotusClient.getRpc().Call(ctx, LOTUS_CLIENT_QUERY_ASK, &clientQueryAsk.Result, minerPeerId, minerFid)
 	if err != nil {
-		logs.GetLogger().Error(err)
-		return nil, err
-	}
-
-	if clientQueryAsk.Error != nil {
-		err := fmt.Errorf("miner:%s,code:%d,message:%s", minerFid, clientQueryAsk.Error.Code, clientQueryAsk.Error.Message)
+		err := fmt.Errorf("miner:%s,%w", minerFid, err)
 		logs.GetLogger().Error(err)
 		return nil, err
 	}
@@ -318,105 +265,55 @@ func (lotusClient *LotusClient) LotusClientQueryAsk(minerFid string) (*MinerConf
 	return minerConfig, nil
 }
 
-func (lotusClient *LotusClient) LotusGetCurrentEpoch() (*int64, error) {
-	var params []interface{}
-
-	jsonRpcParams := LotusJsonRpcParams{
-		JsonRpc: LOTUS_JSON_RPC_VERSION,
-		Method:  LOTUS_CHAIN_HEAD,
-		Params:  params,
-		Id:      LOTUS_JSON_RPC_ID,
-	}
+type ChainHead struct {
+	Height int64
+}
 
-	response, err := web.HttpPostNoToken(lotusClient.ApiUrl, jsonRpcParams)
+func (lotusClient *LotusClient) LotusGetCurrentEpoch() (*int64, error) {
+	chainHead := &ChainHead{}
+	err := lotusClient.getRpc().Call(context.Background(), LOTUS_CHAIN_HEAD, chainHead)
 	if err != nil {
 		logs.GetLogger().Error(err)
 		return nil, err
 	}
 
-	result := utils.GetFieldMapFromJson(response, "result")
-	if result == nil {
-		err := fmt.Errorf("failed to get result from:%s", lotusClient.ApiUrl)
-		logs.GetLogger().Error(err)
-		return nil, err
-	}
-
-	height := result["Height"]
-	if height == nil {
-		err := fmt.Errorf("failed to get height from:%s", lotusClient.ApiUrl)
-		logs.GetLogger().Error(err)
-		return nil, err
-	}
-
-	heightFloat := height.(float64)
-	heightInt64 := int64(heightFloat)
-	return &heightInt64, nil
+	return &chainHead.Height, nil
 }
 
 //"lotus-miner storage-deals list -v | grep -a " + dealCid
+//the name is resolved locally, only codes unknown to StorageDealStatus are sent to the node
 func (lotusClient *LotusClient) LotusGetDealStatus(state int) (*string, error) {
-	var params []interface{}
-	params = append(params, state)
-
-	jsonRpcParams := LotusJsonRpcParams{
-		JsonRpc: LOTUS_JSON_RPC_VERSION,
-		Method:  LOTUS_CLIENT_GET_DEAL_STATUS,
-		Params:  params,
-		Id:      LOTUS_JSON_RPC_ID,
+	if StorageDealStatus(state).IsKnown() {
+		status := StorageDealStatus(state).String()
+		return &status, nil
 	}
 
-	response, err := web.HttpPostNoToken(lotusClient.ApiUrl, jsonRpcParams)
+	var status string
+	err := lotusClient.getRpc().Call(context.Background(), LOTUS_CLIENT_GET_DEAL_STATUS, &status, state)
 	if err != nil {
 		logs.GetLogger().Error(err)
 		return nil, err
 	}
 
-	result := utils.GetFieldStrFromJson(response, "result")
-	if result == "" {
-		logs.GetLogger().Error("no response from:", lotusClient.ApiUrl)
+	if status == "" {
+		err := fmt.Errorf("state:%d, %w from %s", state, ErrEmptyResult, lotusClient.ApiUrl)
+		logs.GetLogger().Error(err)
 		return nil, err
 	}
 
-	return &result, nil
+	return &status, nil
 }
 
 //"lotus client commP " + carFilePath
 func (lotusClient *LotusClient) LotusClientCalcCommP(filepath string) (*string, error) {
-	var params []interface{}
-	params = append(params, filepath)
-
-	jsonRpcParams := LotusJsonRpcParams{
-		JsonRpc: LOTUS_JSON_RPC_VERSION,
-		Method:  LOTUS_CLIENT_CALC_COMM_P,
-		Params:  params,
-		Id:      LOTUS_JSON_RPC_ID,
-	}
-
-	response, err := web.HttpPost(lotusClient.ApiUrl, lotusClient.AccessToken, jsonRpcParams)
-	if err != nil {
-		logs.GetLogger().Error(err)
-		return nil, err
-	}
-
 	clientCalcCommP := &ClientCalcCommP{}
-	err = json.Unmarshal(response, clientCalcCommP)
+	err := lotusClient.getRpc().Call(context.Background(), LOTUS_CLIENT_CALC_COMM_P, &clientCalcCommP.Result, filepath)
 	if err != nil {
+		err := fmt.Errorf("get piece CID failed for:%s, %w", filepath, err)
 		logs.GetLogger().Error(err)
 		return nil, err
 	}
 
-	if clientCalcCommP.Error != nil {
-		err := fmt.Errorf("get piece CID failed for:%s, error code:%d, message:%s", filepath, clientCalcCommP.Error.Code, clientCalcCommP.Error.Message)
-		logs.GetLogger().Error(err)
-		return nil, err
-	}
-
-	if clientCalcCommP.Result == nil {
-		err := fmt.Errorf("no result from:%s", lotusClient.ApiUrl)
-		logs.GetLogger().Error()
-		return nil, err
-	}
-
 	pieceCid := clientCalcCommP.Result.Root.Cid
 	return &pieceCid, nil
 }
@@ -428,41 +325,15 @@ type ClientFileParam struct {
 
 //"lotus client import --car " + carFilePath
 func (lotusClient *LotusClient) LotusClientImport(filepath string, isCar bool) (*string, error) {
-	var params []interface{}
 	clientFileParam := ClientFileParam{
 		Path:  filepath,
 		IsCAR: isCar,
 	}
-	params = append(params, clientFileParam)
-
-	jsonRpcParams := LotusJsonRpcParams{
-		JsonRpc: LOTUS_JSON_RPC_VERSION,
-		Method:  LOTUS_CLIENT_IMPORT,
-		Params:  params,
-		Id:      LOTUS_JSON_RPC_ID,
-	}
-
-	response, err := web.HttpGet(lotusClient.ApiUrl, lotusClient.AccessToken, jsonRpcParams)
-	if err != nil {
-		logs.GetLogger().Error(err)
-		return nil, err
-	}
 
 	clientImport := &ClientImport{}
-	err = json.Unmarshal(response, clientImport)
+	err := lotusClient.getRpc().Call(context.Background(), LOTUS_CLIENT_IMPORT, &clientImport.Result, clientFileParam)
 	if err != nil {
-		logs.GetLogger().Error(err)
-		return nil, err
-	}
-
-	if clientImport.Error != nil {
-		err := fmt.Errorf("lotus import file %s failed, error code:%d, message:%s", filepath, clientImport.Error.Code, clientImport.Error.Message)
-		logs.GetLogger().Error(err)
-		return nil, err
-	}
-
-	if clientImport.Result == nil {
-		err := fmt.Errorf("lotus import file %s failed, result is null from %s", filepath, lotusClient.ApiUrl)
+		err := fmt.Errorf("lotus import file %s failed, %w", filepath, err)
 		logs.GetLogger().Error(err)
 		return nil, err
 	}
@@ -474,41 +345,17 @@ func (lotusClient *LotusClient) LotusClientImport(filepath string, isCar bool) (
 
 //"lotus client generate-car " + srcFilePath + " " + destCarFilePath
 func (lotusClient *LotusClient) LotusClientGenCar(srcFilePath, destCarFilePath string, srcFilePathIsCar bool) error {
-	var params []interface{}
 	clientFileParam := ClientFileParam{
 		Path:  srcFilePath,
 		IsCAR: srcFilePathIsCar,
 	}
-	params = append(params, clientFileParam)
-	params = append(params, destCarFilePath)
-
-	jsonRpcParams := LotusJsonRpcParams{
-		JsonRpc: LOTUS_JSON_RPC_VERSION,
-		Method:  LOTUS_CLIENT_GEN_CAR,
-		Params:  params,
-		Id:      LOTUS_JSON_RPC_ID,
-	}
 
-	response, err := web.HttpGet(lotusClient.ApiUrl, lotusClient.AccessToken, jsonRpcParams)
+	err := lotusClient.getRpc().Call(context.Background(), LOTUS_CLIENT_GEN_CAR, nil, clientFileParam, destCarFilePath)
 	if err != nil {
 		logs.GetLogger().Error(err)
 		return err
 	}
 
-	//logs.GetLogger().Info(response)
-	lotusJsonRpcResult := &LotusJsonRpcResult{}
-	err = json.Unmarshal(response, lotusJsonRpcResult)
-	if err != nil {
-		logs.GetLogger().Error(err)
-		return err
-	}
-
-	if lotusJsonRpcResult.Error != nil {
-		err := fmt.Errorf("error, code:%d, message:%s", lotusJsonRpcResult.Error.Code, lotusJsonRpcResult.Error.Message)
-		logs.GetLogger().Error(err)
-		return err
-	}
-
 	return nil
 }
 
@@ -536,22 +383,27 @@ type ClientStartDeal struct {
 }
 
 func (lotusClient *LotusClient) CheckDuration(duration int, startEpoch int64) error {
-	if duration < constants.DURATION_MIN || duration > constants.DURATION_MAX {
-		err := fmt.Errorf("deal duration out of bounds (min, max, provided): %d, %d, %d", constants.DURATION_MIN, constants.DURATION_MAX, duration)
+	currentEpoch, err := lotusClient.LotusGetCurrentEpoch()
+	if err != nil {
 		logs.GetLogger().Error(err)
 		return err
 	}
 
-	currentEpoch, err := lotusClient.LotusGetCurrentEpoch()
-	if err != nil {
+	return checkDuration(duration, startEpoch, *currentEpoch)
+}
+
+func checkDuration(duration int, startEpoch, currentEpoch int64) error {
+	if duration < constants.DURATION_MIN || duration > constants.DURATION_MAX {
+		err := fmt.Errorf("%w (min, max, provided): %d, %d, %d", ErrDurationOutOfBounds, constants.DURATION_MIN, constants.DURATION_MAX, duration)
 		logs.GetLogger().Error(err)
 		return err
 	}
+
 	endEpoch := startEpoch + (int64)(duration)
 
-	epoch2EndfromNow := endEpoch - *currentEpoch
+	epoch2EndfromNow := endEpoch - currentEpoch
 	if epoch2EndfromNow >= constants.DURATION_MAX {
-		err := fmt.Errorf("invalid deal end epoch %d: cannot be more than %d past current epoch %d", endEpoch, constants.DURATION_MAX, currentEpoch)
+		err := fmt.Errorf("invalid deal end epoch %d: cannot be more than %d past current epoch %d, %w", endEpoch, constants.DURATION_MAX, currentEpoch, ErrDurationOutOfBounds)
 		logs.GetLogger().Error(err)
 		return err
 	}
@@ -567,19 +419,34 @@ func (lotusClient *LotusClient) CheckDealConfig(dealConfig *model.DealConfig) (*
 	}
 
 	if dealConfig.SenderWallet == "" {
-		err := fmt.Errorf("wallet should be set")
+		logs.GetLogger().Error(ErrWalletRequired)
+		return nil, ErrWalletRequired
+	}
+
+	minerConfig, err := lotusClient.LotusClientQueryAsk(dealConfig.MinerFid)
+	if err != nil {
 		logs.GetLogger().Error(err)
 		return nil, err
 	}
 
-	minerConfig, err := lotusClient.LotusClientQueryAsk(dealConfig.MinerFid)
+	currentEpoch, err := lotusClient.LotusGetCurrentEpoch()
 	if err != nil {
 		logs.GetLogger().Error(err)
 		return nil, err
 	}
 
+	return checkDealConfig(dealConfig, minerConfig, *currentEpoch)
+}
+
+//checks dealConfig against the miner's ask without calling the node, the default duration is set when it is 0
+func checkDealConfig(dealConfig *model.DealConfig, minerConfig *MinerConfig, currentEpoch int64) (*decimal.Decimal, error) {
+	if dealConfig.SenderWallet == "" {
+		logs.GetLogger().Error(ErrWalletRequired)
+		return nil, ErrWalletRequired
+	}
+
 	if dealConfig.FileSize < minerConfig.MinPieceSize || dealConfig.FileSize > minerConfig.MaxPieceSize {
-		err := fmt.Errorf("payload cid:%s, file size:%d is outside of miner:%s's range:[%d,%d]", dealConfig.PayloadCid, dealConfig.FileSize, dealConfig.MinerFid, minerConfig.MinPieceSize, minerConfig.MaxPieceSize)
+		err := fmt.Errorf("payload cid:%s, file size:%d is outside of miner:%s's range:[%d,%d], %w", dealConfig.PayloadCid, dealConfig.FileSize, dealConfig.MinerFid, minerConfig.MinPieceSize, minerConfig.MaxPieceSize, ErrPieceSizeOutOfRange)
 		logs.GetLogger().Error(err)
 		return nil, err
 	}
@@ -596,7 +463,7 @@ func (lotusClient *LotusClient) CheckDealConfig(dealConfig *model.DealConfig) (*
 
 	priceCmp := dealConfig.MaxPrice.Cmp(minerPrice)
 	if priceCmp < 0 {
-		err := fmt.Errorf("miner price:%s > deal max price:%s", minerPrice.String(), dealConfig.MaxPrice.String())
+		err := fmt.Errorf("miner price:%s > deal max price:%s, %w", minerPrice.String(), dealConfig.MaxPrice.String(), ErrPriceExceedsMaxPrice)
 		logs.GetLogger().Error(err)
 		return nil, err
 	}
@@ -605,7 +472,7 @@ func (lotusClient *LotusClient) CheckDealConfig(dealConfig *model.DealConfig) (*
 		dealConfig.Duration = constants.DURATION_DEFAULT
 	}
 
-	err = lotusClient.CheckDuration(dealConfig.Duration, dealConfig.StartEpoch)
+	err := checkDuration(dealConfig.Duration, dealConfig.StartEpoch, currentEpoch)
 	if err != nil {
 		logs.GetLogger().Error(err)
 		return nil, err
@@ -621,42 +488,42 @@ func (lotusClient *LotusClient) LotusClientStartDeal(dealConfig *model.DealConfi
 		return nil, err
 	}
 
-	pieceSize, sectorSize := utils.CalculatePieceSize(dealConfig.FileSize)
-	cost := utils.CalculateRealCost(sectorSize, *minerPrice)
-
-	epochPrice := cost.Mul(decimal.NewFromFloat(constants.LOTUS_PRICE_MULTIPLE_1E18))
+	dealSummary := GetDealSummary(dealConfig, *minerPrice)
 
+	//nil deal cid means the deal is not confirmed
 	if !dealConfig.SkipConfirmation {
-		logs.GetLogger().Info("Do you confirm to submit the deal?")
-		logs.GetLogger().Info("Press Y/y to continue, other key to quit")
-		reader := bufio.NewReader(os.Stdin)
-		response, err := reader.ReadString('\n')
+		confirmer := lotusClient.Confirmer
+		if confirmer == nil {
+			confirmer = StdinConfirmer{}
+		}
+
+		confirmed, err := confirmer.Confirm(dealSummary)
 		if err != nil {
 			logs.GetLogger().Error(err)
 			return nil, err
 		}
 
-		response = strings.TrimRight(response, "\n")
-
-		if !strings.EqualFold(response, "Y") {
-			logs.GetLogger().Info("Your input is ", response, ". Now give up submit the deal.")
+		if !confirmed {
 			return nil, nil
 		}
 	}
 
+	return lotusClient.startDeal(context.Background(), dealConfig, dealSummary)
+}
+
+func getClientStartDealParam(dealConfig *model.DealConfig, dealSummary *DealSummary) ClientStartDealParam {
 	clientStartDealParamData := ClientStartDealParamData{
 		TransferType: dealConfig.TransferType, //constants.LOTUS_TRANSFER_TYPE_MANUAL,
 		Root: Cid{
 			Cid: dealConfig.PayloadCid,
 		},
 		PieceCid:  nil,
-		PieceSize: int(pieceSize),
+		PieceSize: int(dealSummary.PieceSize),
 	}
 
-	dealConfig.PieceCid = strings.Trim(dealConfig.PieceCid, " ")
-	if dealConfig.PieceCid != "" {
+	if dealSummary.PieceCid != "" {
 		clientStartDealParamData.PieceCid = &Cid{
-			Cid: dealConfig.PieceCid,
+			Cid: dealSummary.PieceCid,
 		}
 	}
 
@@ -664,41 +531,33 @@ func (lotusClient *LotusClient) LotusClientStartDeal(dealConfig *model.DealConfi
 		Data:              clientStartDealParamData,
 		Wallet:            dealConfig.SenderWallet,
 		Miner:             dealConfig.MinerFid,
-		EpochPrice:        epochPrice.BigInt().String(),
+		EpochPrice:        dealSummary.PricePerEpochAttoFil,
 		MinBlocksDuration: dealConfig.Duration,
 		DealStartEpoch:    dealConfig.StartEpoch,
 		FastRetrieval:     dealConfig.FastRetrieval,
 		VerifiedDeal:      dealConfig.VerifiedDeal,
 	}
 
-	var params []interface{}
-	params = append(params, clientStartDealParam)
-
-	jsonRpcParams := LotusJsonRpcParams{
-		JsonRpc: LOTUS_JSON_RPC_VERSION,
-		Method:  LOTUS_CLIENT_START_DEAL,
-		Params:  params,
-		Id:      LOTUS_JSON_RPC_ID,
-	}
+	return clientStartDealParam
+}
 
-	response, err := web.HttpGet(lotusClient.ApiUrl, lotusClient.AccessToken, jsonRpcParams)
-	if err != nil {
-		logs.GetLogger().Error(err)
-		return nil, err
-	}
+func (lotusClient *LotusClient) startDeal(ctx context.Context, dealConfig *model.DealConfig, dealSummary *DealSummary) (*string, error) {
+	clientStartDealParam := getClientStartDealParam(dealConfig, dealSummary)
 
 	clientStartDeal := &ClientStartDeal{}
-	err = json.Unmarshal([]byte(response), clientStartDeal)
+	err := lotusClient.getRpc().Call(ctx, LOTUS_CLIENT_START_DEAL, &clientStartDeal.Result, clientStartDealParam)
 	if err != nil {
 		logs.GetLogger().Error(err)
 		return nil, err
 	}
 
-	if clientStartDeal.Error != nil {
-		err := fmt.Errorf("error, code:%d, message:%s", clientStartDeal.Error.Code, clientStartDeal.Error.Message)
-		logs.GetLogger().Error(err)
-		return nil, err
+	return &clientStartDeal.Result.Cid, nil
+}
+
+func (lotusClient *LotusClient) getRpc() RpcCaller {
+	if lotusClient.Transport != nil {
+		return lotusClient.Transport
 	}
 
-	return &clientStartDeal.Result.Cid, nil
+	return GetRPC(lotusClient.ApiUrl, lotusClient.AccessToken, lotusClient.RetryPolicy)
 }
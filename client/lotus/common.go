@@ -1,9 +1,7 @@
 package lotus
 
 import (
-	"encoding/json"
-	"errors"
-	"fmt"
+	"context"
 
 	"github.com/filswan/go-swan-lib/client/web"
 	"github.com/filswan/go-swan-lib/logs"
@@ -36,6 +34,14 @@ type Cid struct {
 	Cid string `json:"/"`
 }
 
+//json-rpc requests are sent by POST, so non idempotent requests have to be retried as well,
+//the only non idempotent method, deal proposal, is sent without retry
+func getRpcRetryPolicy() *web.RetryPolicy {
+	retryPolicy := web.DefaultRetryPolicy()
+	retryPolicy.RetryNonIdempotent = true
+	return retryPolicy
+}
+
 const (
 	LOTUS_VERSION = "Filecoin.Version"
 )
@@ -54,35 +60,12 @@ type LotusVersionResponse struct {
 //when using lotus node api url it returns version of lotus node
 //when using lotus miner api url it returns version of lotus miner
 func LotusVersion(apiUrl string) (*string, error) {
-	var params []interface{}
-
-	jsonRpcParams := LotusJsonRpcParams{
-		JsonRpc: LOTUS_JSON_RPC_VERSION,
-		Method:  LOTUS_VERSION,
-		Params:  params,
-		Id:      LOTUS_JSON_RPC_ID,
-	}
-
-	//here the api url should be miner's api url, need to change later on
-	response, err := web.HttpGetNoToken(apiUrl, jsonRpcParams)
-	if err != nil {
-		logs.GetLogger().Error(err)
-		return nil, err
-	}
-
 	lotusVersionResponse := &LotusVersionResponse{}
-	err = json.Unmarshal(response, lotusVersionResponse)
+	err := GetRPC(apiUrl, "", nil).Call(context.Background(), LOTUS_VERSION, &lotusVersionResponse.Result)
 	if err != nil {
 		logs.GetLogger().Error(err)
 		return nil, err
 	}
 
-	if lotusVersionResponse.Error != nil {
-		msg := fmt.Sprintf("error, code:%d, message:%s", lotusVersionResponse.Error.Code, lotusVersionResponse.Error.Message)
-		err := errors.New(msg)
-		logs.GetLogger().Error(err)
-		return nil, err
-	}
-
 	return &lotusVersionResponse.Result.Version, nil
 }
@@ -0,0 +1,114 @@
+package lotus
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/filswan/go-swan-lib/logs"
+	"github.com/filswan/go-swan-lib/model"
+	"github.com/filswan/go-swan-lib/utils"
+
+	"github.com/shopspring/decimal"
+)
+
+//what is shown before a deal is sent
+type DealSummary struct {
+	MinerFid             string
+	Wallet               string
+	PayloadCid           string
+	PieceCid             string
+	PieceSize            int64
+	SectorSize           int64
+	Duration             int
+	StartEpoch           int64
+	VerifiedDeal         bool
+	FastRetrieval        bool
+	MinerPrice           decimal.Decimal // FIL per GiB per epoch, from the miner's ask
+	PricePerEpoch        decimal.Decimal // FIL
+	PricePerEpochAttoFil string
+	TotalCost            decimal.Decimal // FIL, PricePerEpoch * Duration
+}
+
+//decides whether a deal is sent, it is called once for each deal before it is sent
+type Confirmer interface {
+	Confirm(dealSummary *DealSummary) (bool, error)
+}
+
+type ConfirmerFunc func(dealSummary *DealSummary) (bool, error)
+
+func (confirmerFunc ConfirmerFunc) Confirm(dealSummary *DealSummary) (bool, error) {
+	return confirmerFunc(dealSummary)
+}
+
+type AlwaysYesConfirmer struct{}
+
+func (AlwaysYesConfirmer) Confirm(dealSummary *DealSummary) (bool, error) {
+	return true, nil
+}
+
+type AlwaysNoConfirmer struct{}
+
+func (AlwaysNoConfirmer) Confirm(dealSummary *DealSummary) (bool, error) {
+	return false, nil
+}
+
+//prints the summary and reads Y/y as confirmation
+type StdinConfirmer struct {
+	Reader io.Reader // nil means os.Stdin
+}
+
+func (stdinConfirmer StdinConfirmer) Confirm(dealSummary *DealSummary) (bool, error) {
+	reader := stdinConfirmer.Reader
+	if reader == nil {
+		reader = os.Stdin
+	}
+
+	logs.GetLogger().Info("miner:", dealSummary.MinerFid, ", wallet:", dealSummary.Wallet, ", payload cid:", dealSummary.PayloadCid)
+	logs.GetLogger().Info("piece size:", dealSummary.PieceSize, ", duration:", dealSummary.Duration, ", verified:", dealSummary.VerifiedDeal)
+	logs.GetLogger().Info("price per epoch:", dealSummary.PricePerEpoch, " FIL (", dealSummary.PricePerEpochAttoFil, " attoFIL), total cost:", dealSummary.TotalCost, " FIL")
+	logs.GetLogger().Info("Do you confirm to submit the deal?")
+	logs.GetLogger().Info("Press Y/y to continue, other key to quit")
+
+	response, err := bufio.NewReader(reader).ReadString('\n')
+	if err != nil && !(err == io.EOF && response != "") {
+		logs.GetLogger().Error(err)
+		return false, err
+	}
+
+	response = strings.TrimSpace(response)
+	if !strings.EqualFold(response, "Y") {
+		logs.GetLogger().Info("Your input is ", response, ". Now give up submit the deal.")
+		return false, nil
+	}
+
+	return true, nil
+}
+
+//minerPrice is in FIL per GiB per epoch, as returned by CheckDealConfig,
+//the prices are what is sent in the deal proposal
+func GetDealSummary(dealConfig *model.DealConfig, minerPrice decimal.Decimal) *DealSummary {
+	pieceSize, sectorSize := utils.CalculatePieceSize(dealConfig.FileSize)
+	pricePerEpochAttoFil := getPricePerEpochAttoFil(sectorSize, minerPrice)
+	pricePerEpoch := attoFil2Fil(pricePerEpochAttoFil)
+
+	dealSummary := &DealSummary{
+		MinerFid:             dealConfig.MinerFid,
+		Wallet:               dealConfig.SenderWallet,
+		PayloadCid:           dealConfig.PayloadCid,
+		PieceCid:             strings.Trim(dealConfig.PieceCid, " "),
+		PieceSize:            pieceSize,
+		SectorSize:           int64(sectorSize),
+		Duration:             dealConfig.Duration,
+		StartEpoch:           dealConfig.StartEpoch,
+		VerifiedDeal:         dealConfig.VerifiedDeal,
+		FastRetrieval:        dealConfig.FastRetrieval,
+		MinerPrice:           minerPrice,
+		PricePerEpoch:        pricePerEpoch,
+		PricePerEpochAttoFil: pricePerEpochAttoFil.BigInt().String(),
+		TotalCost:            pricePerEpoch.Mul(decimal.NewFromInt(int64(dealConfig.Duration))),
+	}
+
+	return dealSummary
+}
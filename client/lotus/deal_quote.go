@@ -0,0 +1,132 @@
+package lotus
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/filswan/go-swan-lib/constants"
+	"github.com/filswan/go-swan-lib/logs"
+	"github.com/filswan/go-swan-lib/model"
+	"github.com/filswan/go-swan-lib/utils"
+
+	"github.com/shopspring/decimal"
+)
+
+const LOTUS_STATE_DEAL_PROVIDER_COLLATERAL_BOUNDS = "Filecoin.StateDealProviderCollateralBounds"
+
+//all prices and costs are in FIL
+type DealCostQuote struct {
+	MinerFid              string
+	PieceSize             int64 // unpadded
+	SectorSize            int64 // padded piece size
+	Duration              int
+	VerifiedDeal          bool
+	PricePerEpoch         decimal.Decimal // of the pricing used by the deal, verified or regular
+	TotalCost             decimal.Decimal // PricePerEpoch * Duration
+	RegularPricePerEpoch  decimal.Decimal
+	RegularTotalCost      decimal.Decimal
+	VerifiedPricePerEpoch decimal.Decimal
+	VerifiedTotalCost     decimal.Decimal
+	ProviderCollateralMin decimal.Decimal // 0 unless got from the node by LotusGetDealQuote
+	ProviderCollateralMax decimal.Decimal // 0 unless got from the node by LotusGetDealQuote
+}
+
+type StateDealProviderCollateralBounds struct {
+	Min string
+	Max string
+}
+
+//estimates the cost of a deal from the miner's ask without calling the node,
+//the prices in minerConfig are in attoFIL per GiB per epoch as returned by LotusClientQueryAsk
+func DealQuote(dealConfig model.DealConfig, minerConfig MinerConfig) (*DealCostQuote, error) {
+	if dealConfig.FileSize <= 0 {
+		err := fmt.Errorf("payload cid:%s, file size should be greater than 0", dealConfig.PayloadCid)
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	duration := dealConfig.Duration
+	if duration == 0 {
+		duration = constants.DURATION_DEFAULT
+	}
+
+	pieceSize, sectorSize := utils.CalculatePieceSize(dealConfig.FileSize)
+	regularPricePerEpoch := getPricePerEpoch(sectorSize, attoFil2Fil(minerConfig.Price))
+	verifiedPricePerEpoch := getPricePerEpoch(sectorSize, attoFil2Fil(minerConfig.VerifiedPrice))
+
+	dealCostQuote := &DealCostQuote{
+		MinerFid:              dealConfig.MinerFid,
+		PieceSize:             pieceSize,
+		SectorSize:            int64(sectorSize),
+		Duration:              duration,
+		VerifiedDeal:          dealConfig.VerifiedDeal,
+		RegularPricePerEpoch:  regularPricePerEpoch,
+		RegularTotalCost:      regularPricePerEpoch.Mul(decimal.NewFromInt(int64(duration))),
+		VerifiedPricePerEpoch: verifiedPricePerEpoch,
+		VerifiedTotalCost:     verifiedPricePerEpoch.Mul(decimal.NewFromInt(int64(duration))),
+	}
+
+	dealCostQuote.PricePerEpoch = dealCostQuote.RegularPricePerEpoch
+	dealCostQuote.TotalCost = dealCostQuote.RegularTotalCost
+	if dealConfig.VerifiedDeal {
+		dealCostQuote.PricePerEpoch = dealCostQuote.VerifiedPricePerEpoch
+		dealCostQuote.TotalCost = dealCostQuote.VerifiedTotalCost
+	}
+
+	return dealCostQuote, nil
+}
+
+//price per epoch in FIL as sent in a deal proposal, which is rounded down to attoFIL,
+//minerPrice is in FIL per GiB per epoch
+func getPricePerEpoch(sectorSize float64, minerPrice decimal.Decimal) decimal.Decimal {
+	return attoFil2Fil(getPricePerEpochAttoFil(sectorSize, minerPrice))
+}
+
+func getPricePerEpochAttoFil(sectorSize float64, minerPrice decimal.Decimal) decimal.Decimal {
+	e18 := decimal.NewFromFloat(constants.LOTUS_PRICE_MULTIPLE_1E18)
+	return utils.CalculateRealCost(sectorSize, minerPrice).Mul(e18).Truncate(0)
+}
+
+//exact, unlike Div which rounds to decimal.DivisionPrecision digits
+func attoFil2Fil(attoFil decimal.Decimal) decimal.Decimal {
+	return attoFil.Shift(-18)
+}
+
+//queries the miner's ask and the provider collateral bounds, then quotes the deal
+func (lotusClient *LotusClient) LotusGetDealQuote(dealConfig model.DealConfig) (*DealCostQuote, error) {
+	minerConfig, err := lotusClient.LotusClientQueryAsk(dealConfig.MinerFid)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	dealCostQuote, err := DealQuote(dealConfig, *minerConfig)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	collateralBounds := &StateDealProviderCollateralBounds{}
+	err = lotusClient.getRpc().Call(context.Background(), LOTUS_STATE_DEAL_PROVIDER_COLLATERAL_BOUNDS, collateralBounds, dealCostQuote.SectorSize, dealConfig.VerifiedDeal, nil)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	collateralMin, err := decimal.NewFromString(collateralBounds.Min)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	collateralMax, err := decimal.NewFromString(collateralBounds.Max)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	dealCostQuote.ProviderCollateralMin = attoFil2Fil(collateralMin)
+	dealCostQuote.ProviderCollateralMax = attoFil2Fil(collateralMax)
+
+	return dealCostQuote, nil
+}
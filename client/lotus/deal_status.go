@@ -0,0 +1,111 @@
+package lotus
+
+import "fmt"
+
+//storage deal states, in the same order as StorageDealStatus in go-fil-markets
+type StorageDealStatus int
+
+const (
+	StorageDealUnknown StorageDealStatus = iota
+	StorageDealProposalNotFound
+	StorageDealProposalRejected
+	StorageDealProposalAccepted
+	StorageDealStaged
+	StorageDealSealing
+	StorageDealFinalizing
+	StorageDealActive
+	StorageDealExpired
+	StorageDealSlashed
+	StorageDealRejecting
+	StorageDealFailing
+	StorageDealFundsReserved
+	StorageDealCheckForAcceptance
+	StorageDealValidating
+	StorageDealAcceptWait
+	StorageDealStartDataTransfer
+	StorageDealTransferring
+	StorageDealWaitingForData
+	StorageDealVerifyData
+	StorageDealReserveProviderFunds
+	StorageDealReserveClientFunds
+	StorageDealProviderFunding
+	StorageDealClientFunding
+	StorageDealPublish
+	StorageDealPublishing
+	StorageDealError
+	StorageDealProviderTransferAwaitRestart
+	StorageDealClientTransferRestart
+	StorageDealAwaitingPreCommit
+)
+
+var storageDealStatusNames = map[StorageDealStatus]string{
+	StorageDealUnknown:                      "StorageDealUnknown",
+	StorageDealProposalNotFound:             "StorageDealProposalNotFound",
+	StorageDealProposalRejected:             "StorageDealProposalRejected",
+	StorageDealProposalAccepted:             "StorageDealProposalAccepted",
+	StorageDealStaged:                       "StorageDealStaged",
+	StorageDealSealing:                      "StorageDealSealing",
+	StorageDealFinalizing:                   "StorageDealFinalizing",
+	StorageDealActive:                       "StorageDealActive",
+	StorageDealExpired:                      "StorageDealExpired",
+	StorageDealSlashed:                      "StorageDealSlashed",
+	StorageDealRejecting:                    "StorageDealRejecting",
+	StorageDealFailing:                      "StorageDealFailing",
+	StorageDealFundsReserved:                "StorageDealFundsReserved",
+	StorageDealCheckForAcceptance:           "StorageDealCheckForAcceptance",
+	StorageDealValidating:                   "StorageDealValidating",
+	StorageDealAcceptWait:                   "StorageDealAcceptWait",
+	StorageDealStartDataTransfer:            "StorageDealStartDataTransfer",
+	StorageDealTransferring:                 "StorageDealTransferring",
+	StorageDealWaitingForData:               "StorageDealWaitingForData",
+	StorageDealVerifyData:                   "StorageDealVerifyData",
+	StorageDealReserveProviderFunds:         "StorageDealReserveProviderFunds",
+	StorageDealReserveClientFunds:           "StorageDealReserveClientFunds",
+	StorageDealProviderFunding:              "StorageDealProviderFunding",
+	StorageDealClientFunding:                "StorageDealClientFunding",
+	StorageDealPublish:                      "StorageDealPublish",
+	StorageDealPublishing:                   "StorageDealPublishing",
+	StorageDealError:                        "StorageDealError",
+	StorageDealProviderTransferAwaitRestart: "StorageDealProviderTransferAwaitRestart",
+	StorageDealClientTransferRestart:        "StorageDealClientTransferRestart",
+	StorageDealAwaitingPreCommit:            "StorageDealAwaitingPreCommit",
+}
+
+func (status StorageDealStatus) String() string {
+	name, ok := storageDealStatusNames[status]
+	if !ok {
+		return fmt.Sprintf("StorageDealStatus(%d)", int(status))
+	}
+
+	return name
+}
+
+//false for codes added to lotus after this list, their names can only be got from the node
+func (status StorageDealStatus) IsKnown() bool {
+	_, ok := storageDealStatusNames[status]
+	return ok
+}
+
+//no further state change is expected, except that an active deal expires or is slashed at last
+func (status StorageDealStatus) IsTerminal() bool {
+	switch status {
+	case StorageDealActive, StorageDealExpired, StorageDealSlashed, StorageDealError, StorageDealProposalNotFound, StorageDealProposalRejected:
+		return true
+	default:
+		return false
+	}
+}
+
+//the deal failed or is failing
+func (status StorageDealStatus) IsFailure() bool {
+	switch status {
+	case StorageDealProposalNotFound, StorageDealProposalRejected, StorageDealSlashed, StorageDealError, StorageDealFailing, StorageDealRejecting:
+		return true
+	default:
+		return false
+	}
+}
+
+func (status StorageDealStatus) IsActive() bool {
+	return status == StorageDealActive
+}
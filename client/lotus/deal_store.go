@@ -0,0 +1,135 @@
+package lotus
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/filswan/go-swan-lib/logs"
+
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+const DEAL_STATE_KEY_PREFIX = "deal_state:"
+
+//last seen state of a deal
+type DealState struct {
+	ProposalCid string            `json:"proposal_cid"`
+	State       StorageDealStatus `json:"state"`
+	Message     string            `json:"message"`
+	UpdatedAt   time.Time         `json:"updated_at"`
+}
+
+type DealStateStore interface {
+	Get(proposalCid string) (*DealState, error) // nil, nil when the deal is not found
+	Put(dealState DealState) error
+	Delete(proposalCid string) error
+}
+
+//keeps deal states in memory, they are lost when the process exits
+type MemoryDealStateStore struct {
+	mutex      sync.RWMutex
+	dealStates map[string]DealState
+}
+
+func GetMemoryDealStateStore() *MemoryDealStateStore {
+	return &MemoryDealStateStore{dealStates: map[string]DealState{}}
+}
+
+func (store *MemoryDealStateStore) Get(proposalCid string) (*DealState, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	dealState, ok := store.dealStates[proposalCid]
+	if !ok {
+		return nil, nil
+	}
+
+	return &dealState, nil
+}
+
+func (store *MemoryDealStateStore) Put(dealState DealState) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	if store.dealStates == nil {
+		store.dealStates = map[string]DealState{}
+	}
+
+	store.dealStates[dealState.ProposalCid] = dealState
+	return nil
+}
+
+func (store *MemoryDealStateStore) Delete(proposalCid string) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	delete(store.dealStates, proposalCid)
+	return nil
+}
+
+//keeps deal states in a leveldb database, the database stays open until Close is called
+type LevelDbDealStateStore struct {
+	db *leveldb.DB
+}
+
+func GetLevelDbDealStateStore(dbFilepath string) (*LevelDbDealStateStore, error) {
+	db, err := leveldb.OpenFile(dbFilepath, nil)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	return &LevelDbDealStateStore{db: db}, nil
+}
+
+func (store *LevelDbDealStateStore) Get(proposalCid string) (*DealState, error) {
+	data, err := store.db.Get([]byte(DEAL_STATE_KEY_PREFIX+proposalCid), nil)
+	if err != nil {
+		if errors.Is(err, leveldb.ErrNotFound) {
+			return nil, nil
+		}
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	dealState := &DealState{}
+	err = json.Unmarshal(data, dealState)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	return dealState, nil
+}
+
+func (store *LevelDbDealStateStore) Put(dealState DealState) error {
+	data, err := json.Marshal(dealState)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	err = store.db.Put([]byte(DEAL_STATE_KEY_PREFIX+dealState.ProposalCid), data, nil)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	return nil
+}
+
+func (store *LevelDbDealStateStore) Delete(proposalCid string) error {
+	err := store.db.Delete([]byte(DEAL_STATE_KEY_PREFIX+proposalCid), nil)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	return nil
+}
+
+func (store *LevelDbDealStateStore) Close() error {
+	return store.db.Close()
+}
@@ -0,0 +1,283 @@
+package lotus
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/filswan/go-swan-lib/logs"
+)
+
+const (
+	DEAL_TRACKER_INTERVAL_DEFAULT     = time.Minute
+	DEAL_TRACKER_EVENT_BUFFER_DEFAULT = 100
+
+	HEAD_CHANGE_TYPE_APPLY = "apply"
+)
+
+//state transition of a watched deal, OldState is StorageDealUnknown when the deal is seen the first time
+type DealEvent struct {
+	ProposalCid string
+	OldState    StorageDealStatus
+	NewState    StorageDealStatus
+	Message     string
+	Time        time.Time
+}
+
+//watches a set of deals on a market node, all of them are checked with one MarketListIncompleteDeals call,
+//a DealTracker built as a struct literal works as one from GetDealTracker
+type DealTracker struct {
+	LotusMarket   *LotusMarket
+	Store         DealStateStore // last seen states, so that a restarted tracker emits only new transitions, nil means in memory
+	Interval      time.Duration  // polling interval, 0 means DEAL_TRACKER_INTERVAL_DEFAULT
+	ChainNotifier *WsRPC         // when set, deals are also checked on each new tipset
+	EventBuffer   int            // size of the channel returned by Start, 0 means DEAL_TRACKER_EVENT_BUFFER_DEFAULT
+	KeepTerminal  bool           // when false, a deal is unwatched once it reaches a terminal state
+
+	mutex     sync.Mutex
+	pollMutex sync.Mutex
+	watched   map[string]*DealState // nil when the deal is not seen yet
+}
+
+//store can be nil, then the states are kept in memory only
+func GetDealTracker(lotusMarket *LotusMarket, store DealStateStore) (*DealTracker, error) {
+	if lotusMarket == nil {
+		err := fmt.Errorf("lotus market is required")
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	if store == nil {
+		store = GetMemoryDealStateStore()
+	}
+
+	dealTracker := &DealTracker{
+		LotusMarket: lotusMarket,
+		Store:       store,
+		Interval:    DEAL_TRACKER_INTERVAL_DEFAULT,
+		watched:     map[string]*DealState{},
+	}
+
+	return dealTracker, nil
+}
+
+func (dealTracker *DealTracker) getStore() DealStateStore {
+	dealTracker.mutex.Lock()
+	defer dealTracker.mutex.Unlock()
+
+	if dealTracker.Store == nil {
+		dealTracker.Store = GetMemoryDealStateStore()
+	}
+
+	return dealTracker.Store
+}
+
+//adds deals to watch, their last seen states are loaded from the store,
+//deals already in a terminal state are skipped unless KeepTerminal is set
+func (dealTracker *DealTracker) Watch(proposalCids ...string) error {
+	store := dealTracker.getStore()
+	dealStates := map[string]*DealState{}
+	for _, proposalCid := range proposalCids {
+		dealState, err := store.Get(proposalCid)
+		if err != nil {
+			logs.GetLogger().Error(err)
+			return err
+		}
+		dealStates[proposalCid] = dealState
+	}
+
+	dealTracker.mutex.Lock()
+	defer dealTracker.mutex.Unlock()
+
+	if dealTracker.watched == nil {
+		dealTracker.watched = map[string]*DealState{}
+	}
+
+	for proposalCid, dealState := range dealStates {
+		if dealState != nil && dealState.State.IsTerminal() && !dealTracker.KeepTerminal {
+			continue
+		}
+
+		if _, ok := dealTracker.watched[proposalCid]; !ok {
+			dealTracker.watched[proposalCid] = dealState
+		}
+	}
+
+	return nil
+}
+
+//stops watching deals, their last seen states are kept in the store
+func (dealTracker *DealTracker) Unwatch(proposalCids ...string) {
+	dealTracker.mutex.Lock()
+	defer dealTracker.mutex.Unlock()
+
+	for _, proposalCid := range proposalCids {
+		delete(dealTracker.watched, proposalCid)
+	}
+}
+
+func (dealTracker *DealTracker) Watching() []string {
+	dealTracker.mutex.Lock()
+	defer dealTracker.mutex.Unlock()
+
+	proposalCids := make([]string, 0, len(dealTracker.watched))
+	for proposalCid := range dealTracker.watched {
+		proposalCids = append(proposalCids, proposalCid)
+	}
+
+	return proposalCids
+}
+
+//checks all watched deals once and returns their transitions since the last check,
+//deals not listed by the market node are skipped
+func (dealTracker *DealTracker) Poll(ctx context.Context) ([]DealEvent, error) {
+	dealTracker.pollMutex.Lock()
+	defer dealTracker.pollMutex.Unlock()
+
+	if len(dealTracker.Watching()) == 0 {
+		return nil, nil
+	}
+
+	deals, err := dealTracker.LotusMarket.listIncompleteDeals(ctx)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	store := dealTracker.getStore()
+	now := time.Now()
+	var dealEvents []DealEvent
+	for _, deal := range deals {
+		proposalCid := deal.ProposalCid.DealCid
+
+		dealTracker.mutex.Lock()
+		lastDealState, ok := dealTracker.watched[proposalCid]
+		dealTracker.mutex.Unlock()
+		if !ok {
+			continue
+		}
+
+		oldState := StorageDealUnknown
+		if lastDealState != nil {
+			if lastDealState.State == StorageDealStatus(deal.State) && lastDealState.Message == deal.Message {
+				continue
+			}
+			oldState = lastDealState.State
+		}
+
+		newState := StorageDealStatus(deal.State)
+		dealState := DealState{
+			ProposalCid: proposalCid,
+			State:       newState,
+			Message:     deal.Message,
+			UpdatedAt:   now,
+		}
+
+		err = store.Put(dealState)
+		if err != nil {
+			logs.GetLogger().Error(err)
+			return dealEvents, err
+		}
+
+		dealTracker.mutex.Lock()
+		if _, ok := dealTracker.watched[proposalCid]; ok {
+			if newState.IsTerminal() && !dealTracker.KeepTerminal {
+				delete(dealTracker.watched, proposalCid)
+			} else {
+				dealTracker.watched[proposalCid] = &dealState
+			}
+		}
+		dealTracker.mutex.Unlock()
+
+		if oldState == newState && lastDealState != nil {
+			continue //only the message changed
+		}
+
+		dealEvents = append(dealEvents, DealEvent{
+			ProposalCid: proposalCid,
+			OldState:    oldState,
+			NewState:    newState,
+			Message:     deal.Message,
+			Time:        now,
+		})
+	}
+
+	return dealEvents, nil
+}
+
+//polls until ctx is done, the returned channel is closed then,
+//polling errors are logged and the next tick is waited for
+func (dealTracker *DealTracker) Start(ctx context.Context) <-chan DealEvent {
+	eventBuffer := dealTracker.EventBuffer
+	if eventBuffer <= 0 {
+		eventBuffer = DEAL_TRACKER_EVENT_BUFFER_DEFAULT
+	}
+
+	interval := dealTracker.Interval
+	if interval <= 0 {
+		interval = DEAL_TRACKER_INTERVAL_DEFAULT
+	}
+
+	var headChangesCh <-chan []HeadChange
+	if dealTracker.ChainNotifier != nil {
+		var err error
+		headChangesCh, err = dealTracker.ChainNotifier.ChainNotify(ctx)
+		if err != nil {
+			logs.GetLogger().Error("failed to subscribe to new tipsets, polling every ", interval, ":", err)
+		}
+	}
+
+	dealEventsCh := make(chan DealEvent, eventBuffer)
+	go func() {
+		defer close(dealEventsCh)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			dealEvents, err := dealTracker.Poll(ctx)
+			if err != nil {
+				logs.GetLogger().Error(err)
+			}
+
+			for _, dealEvent := range dealEvents {
+				select {
+				case dealEventsCh <- dealEvent:
+				case <-ctx.Done():
+					return
+				}
+			}
+
+			if !dealTracker.waitNextTick(ctx, ticker, &headChangesCh) {
+				return
+			}
+		}
+	}()
+
+	return dealEventsCh
+}
+
+//returns false when ctx is done
+func (dealTracker *DealTracker) waitNextTick(ctx context.Context, ticker *time.Ticker, headChangesCh *<-chan []HeadChange) bool {
+	for {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-ticker.C:
+			return true
+		case headChanges, ok := <-*headChangesCh:
+			if !ok {
+				logs.GetLogger().Info("tipset subscription closed, fall back to polling")
+				*headChangesCh = nil
+				continue
+			}
+
+			for _, headChange := range headChanges {
+				if headChange.Type == HEAD_CHANGE_TYPE_APPLY {
+					return true
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package lotus
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/filswan/go-swan-lib/client/web"
+)
+
+const (
+	JSON_RPC_ERROR_CODE_METHOD_NOT_FOUND = -32601
+
+	DEAL_STAGE_VALIDATE  = "validate"
+	DEAL_STAGE_QUERY_ASK = "query ask"
+	DEAL_STAGE_BUDGET    = "budget"
+	DEAL_STAGE_CONFIRM   = "confirm"
+	DEAL_STAGE_PROPOSE   = "propose"
+)
+
+var (
+	ErrWalletRequired       = errors.New("wallet should be set")
+	ErrPieceSizeOutOfRange  = errors.New("file size is outside of miner's range")
+	ErrPriceExceedsMaxPrice = errors.New("miner price exceeds deal max price")
+	ErrDurationOutOfBounds  = errors.New("deal duration out of bounds")
+	ErrDealNotConfirmed     = errors.New("deal is not confirmed")
+	ErrWalletNotVerified    = errors.New("wallet is not a verified client")
+)
+
+type RpcError struct {
+	Code    int
+	Message string
+	Method  string
+}
+
+func newRpcError(method string, jsonRpcError *JsonRpcError) *RpcError {
+	return &RpcError{
+		Code:    jsonRpcError.Code,
+		Message: jsonRpcError.Message,
+		Method:  method,
+	}
+}
+
+func (e *RpcError) Error() string {
+	return fmt.Sprintf("%s failed, code:%d, message:%s", e.Method, e.Code, e.Message)
+}
+
+//lotus reports missing permission like: missing permission to invoke 'MarketImportDealData' (need 'write')
+func (e *RpcError) Is(target error) bool {
+	switch target {
+	case web.ErrInsufficientPermission:
+		return strings.Contains(e.Message, "missing permission") || strings.Contains(e.Message, "(need '")
+	case web.ErrUnauthorized:
+		return strings.Contains(e.Message, "token not valid")
+	case web.ErrNotFound:
+		return e.Code == JSON_RPC_ERROR_CODE_METHOD_NOT_FOUND || strings.Contains(e.Message, "not found")
+	default:
+		return false
+	}
+}
+
+//error of one deal in a batch, Stage tells how far the deal went
+type DealError struct {
+	Stage      string
+	MinerFid   string
+	PayloadCid string
+	Err        error
+}
+
+func (e *DealError) Error() string {
+	return fmt.Sprintf("%s failed, miner:%s, payload cid:%s, %s", e.Stage, e.MinerFid, e.PayloadCid, e.Err)
+}
+
+func (e *DealError) Unwrap() error {
+	return e.Err
+}
@@ -1,13 +1,12 @@
 package lotus
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
 	"fmt"
-	"strings"
 
 	"github.com/filswan/go-swan-lib/client/web"
 	"github.com/filswan/go-swan-lib/logs"
-	"github.com/filswan/go-swan-lib/utils"
 )
 
 const (
@@ -20,6 +19,8 @@ type LotusMarket struct {
 	ApiUrl       string
 	AccessToken  string
 	ClientApiUrl string
+	RetryPolicy  *web.RetryPolicy // nil means no retry
+	Transport    RpcCaller        // nil means json-rpc over http, set a WsRPC to share a websocket connection
 }
 
 type MarketGetAsk struct {
@@ -51,6 +52,7 @@ func GetLotusMarket(apiUrl, accessToken, clientApiUrl string) (*LotusMarket, err
 		ApiUrl:       apiUrl,
 		AccessToken:  accessToken,
 		ClientApiUrl: clientApiUrl,
+		RetryPolicy:  getRpcRetryPolicy(),
 	}
 
 	return lotusMarket, nil
@@ -58,35 +60,13 @@ func GetLotusMarket(apiUrl, accessToken, clientApiUrl string) (*LotusMarket, err
 
 //"lotus client query-ask " + minerFid
 func (lotusMarket *LotusMarket) LotusMarketGetAsk() (*MarketGetAskResultAsk, error) {
-	var params []interface{}
-
-	jsonRpcParams := LotusJsonRpcParams{
-		JsonRpc: LOTUS_JSON_RPC_VERSION,
-		Method:  LOTUS_MARKET_GET_ASK,
-		Params:  params,
-		Id:      LOTUS_JSON_RPC_ID,
-	}
-
-	//here the api url should be miner's api url, need to change later on
-	response, err := web.HttpGetNoToken(lotusMarket.ApiUrl, jsonRpcParams)
-	if err != nil {
-		logs.GetLogger().Error(err)
-		return nil, err
-	}
-
 	marketGetAsk := &MarketGetAsk{}
-	err = json.Unmarshal(response, marketGetAsk)
+	err := lotusMarket.getRpc().Call(context.Background(), LOTUS_MARKET_GET_ASK, &marketGetAsk.Result)
 	if err != nil {
 		logs.GetLogger().Error(err)
 		return nil, err
 	}
 
-	if marketGetAsk.Error != nil {
-		err := fmt.Errorf("%d,%s", marketGetAsk.Error.Code, marketGetAsk.Error.Message)
-		logs.GetLogger().Error(err)
-		return nil, err
-	}
-
 	return &marketGetAsk.Result.Ask, nil
 }
 
@@ -108,22 +88,12 @@ type Deal struct {
 }
 
 func (lotusMarket *LotusMarket) LotusGetDeals() ([]Deal, error) {
-	var params []interface{}
-	jsonRpcParams := LotusJsonRpcParams{
-		JsonRpc: LOTUS_JSON_RPC_VERSION,
-		Method:  LOTUS_MARKET_LIST_INCOMPLETE_DEALS,
-		Params:  params,
-		Id:      LOTUS_JSON_RPC_ID,
-	}
-
-	response, err := web.HttpGet(lotusMarket.ApiUrl, lotusMarket.AccessToken, jsonRpcParams)
-	if err != nil {
-		logs.GetLogger().Error(err)
-		return nil, err
-	}
+	return lotusMarket.listIncompleteDeals(context.Background())
+}
 
+func (lotusMarket *LotusMarket) listIncompleteDeals(ctx context.Context) ([]Deal, error) {
 	deals := &MarketListIncompleteDeals{}
-	err = json.Unmarshal(response, deals)
+	err := lotusMarket.getRpc().Call(ctx, LOTUS_MARKET_LIST_INCOMPLETE_DEALS, &deals.Result)
 	if err != nil {
 		logs.GetLogger().Error(err)
 		return nil, err
@@ -139,16 +109,22 @@ func (lotusMarket *LotusMarket) LotusGetDealOnChainStatusFromDeals(deals []Deal,
 		return nil, nil, err
 	}
 
-	lotusClient, err := LotusGetClient(lotusMarket.ClientApiUrl, "")
-	if err != nil {
-		logs.GetLogger().Error(err)
-		return nil, nil, err
-	}
 	for _, deal := range deals {
 		if deal.ProposalCid.DealCid != dealCid {
 			continue
 		}
 
+		if StorageDealStatus(deal.State).IsKnown() {
+			status := StorageDealStatus(deal.State).String()
+			return &status, &deal.Message, nil
+		}
+
+		lotusClient, err := LotusGetClient(lotusMarket.ClientApiUrl, "")
+		if err != nil {
+			logs.GetLogger().Error(err)
+			return nil, nil, err
+		}
+
 		status, err := lotusClient.LotusGetDealStatus(deal.State)
 		if err != nil {
 			logs.GetLogger().Error(err)
@@ -178,36 +154,23 @@ func (lotusMarket *LotusMarket) LotusGetDealOnChainStatus(dealCid string) (*stri
 }
 
 func (lotusMarket *LotusMarket) LotusImportData(dealCid string, filepath string) error {
-	var params []interface{}
 	getDealInfoParam := DealCid{DealCid: dealCid}
-	params = append(params, getDealInfoParam)
-	params = append(params, filepath)
-
-	jsonRpcParams := LotusJsonRpcParams{
-		JsonRpc: LOTUS_JSON_RPC_VERSION,
-		Method:  LOTUS_MARKET_IMPORT_DATA,
-		Params:  params,
-		Id:      LOTUS_JSON_RPC_ID,
-	}
-
-	response, err := web.HttpPost(lotusMarket.ApiUrl, lotusMarket.AccessToken, jsonRpcParams)
-	if err != nil {
-		logs.GetLogger().Error(err)
-		return err
-	}
-
-	errorInfo := utils.GetFieldMapFromJson(response, "error")
-
-	if errorInfo == nil {
+	err := lotusMarket.getRpc().Call(context.Background(), LOTUS_MARKET_IMPORT_DATA, nil, getDealInfoParam, filepath)
+	if err == nil {
 		return nil
 	}
 
-	errCode := int(errorInfo["code"].(float64))
-	errMsg := errorInfo["message"].(string)
-	err = fmt.Errorf("error code:%d message:%s", errCode, errMsg)
-	if strings.Contains(string(response), "(need 'write')") {
+	logs.GetLogger().Error(err)
+	if errors.Is(err, web.ErrInsufficientPermission) {
 		logs.GetLogger().Error("please check your access token, it should have write access")
-		logs.GetLogger().Error(err)
 	}
 	return err
 }
+
+func (lotusMarket *LotusMarket) getRpc() RpcCaller {
+	if lotusMarket.Transport != nil {
+		return lotusMarket.Transport
+	}
+
+	return GetRPC(lotusMarket.ApiUrl, lotusMarket.AccessToken, lotusMarket.RetryPolicy)
+}
@@ -0,0 +1,192 @@
+package lotus
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/filswan/go-swan-lib/client/web"
+	"github.com/filswan/go-swan-lib/logs"
+)
+
+var ErrEmptyResult = errors.New("empty result")
+
+//methods which must not be sent twice, they are never retried
+var nonIdempotentMethods = map[string]bool{
+	LOTUS_CLIENT_START_DEAL:  true,
+	LOTUS_CLIENT_IMPORT:      true,
+	LOTUS_MARKET_IMPORT_DATA: true,
+}
+
+var rpcRequestId int64 = LOTUS_JSON_RPC_ID
+
+type RPC struct {
+	ApiUrl      string
+	AccessToken string           // sent as bearer token when not empty
+	RetryPolicy *web.RetryPolicy // nil means no retry
+}
+
+type RpcRequest struct {
+	Method string
+	Params []interface{}
+	Result interface{} // pointer to decode the result into, nil when the result is not needed
+	Error  error       // set by CallBatch
+}
+
+type rpcResponse struct {
+	Id      int             `json:"id"`
+	JsonRpc string          `json:"jsonrpc"`
+	Result  json.RawMessage `json:"result"`
+	Error   *JsonRpcError   `json:"error"`
+}
+
+func GetRPC(apiUrl, accessToken string, retryPolicy *web.RetryPolicy) *RPC {
+	rpc := &RPC{
+		ApiUrl:      apiUrl,
+		AccessToken: accessToken,
+		RetryPolicy: retryPolicy,
+	}
+
+	return rpc
+}
+
+func getRpcRequestId() int {
+	return int(atomic.AddInt64(&rpcRequestId, 1))
+}
+
+func getJsonRpcParams(method string, params []interface{}) LotusJsonRpcParams {
+	if params == nil {
+		params = []interface{}{}
+	}
+
+	jsonRpcParams := LotusJsonRpcParams{
+		JsonRpc: LOTUS_JSON_RPC_VERSION,
+		Method:  method,
+		Params:  params,
+		Id:      getRpcRequestId(),
+	}
+
+	return jsonRpcParams
+}
+
+func (rpc *RPC) getWebClient(methods ...string) *web.Client {
+	for _, method := range methods {
+		if nonIdempotentMethods[method] {
+			return web.GetDefaultClient()
+		}
+	}
+
+	return web.GetDefaultClient().WithRetryPolicy(rpc.RetryPolicy)
+}
+
+//calls method and decodes its result into result, which should be a pointer or nil,
+//a null result is reported as ErrEmptyResult unless result is nil
+func (rpc *RPC) Call(ctx context.Context, method string, result interface{}, params ...interface{}) error {
+	if len(rpc.ApiUrl) == 0 {
+		err := fmt.Errorf("lotus api url is required")
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	jsonRpcParams := getJsonRpcParams(method, params)
+
+	response, err := rpc.getWebClient(method).Post(ctx, rpc.ApiUrl, rpc.AccessToken, jsonRpcParams)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	rpcResponse := &rpcResponse{}
+	err = json.Unmarshal(response, rpcResponse)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	err = rpc.decodeResponse(method, rpcResponse, result)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	return nil
+}
+
+func (rpc *RPC) decodeResponse(method string, rpcResponse *rpcResponse, result interface{}) error {
+	if rpcResponse.Error != nil {
+		return newRpcError(method, rpcResponse.Error)
+	}
+
+	if result == nil {
+		return nil
+	}
+
+	if len(rpcResponse.Result) == 0 || string(rpcResponse.Result) == "null" {
+		return fmt.Errorf("%s: %w from %s", method, ErrEmptyResult, rpc.ApiUrl)
+	}
+
+	err := json.Unmarshal(rpcResponse.Result, result)
+	if err != nil {
+		return fmt.Errorf("%s: failed to decode result, %w", method, err)
+	}
+
+	return nil
+}
+
+//sends all requests in one json-rpc 2.0 batch, the node should support batch requests,
+//the error of each request is set to its Error field, the returned error is for the whole batch
+func (rpc *RPC) CallBatch(ctx context.Context, requests []*RpcRequest) error {
+	if len(requests) == 0 {
+		return nil
+	}
+
+	if len(rpc.ApiUrl) == 0 {
+		err := fmt.Errorf("lotus api url is required")
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	var methods []string
+	var batchParams []LotusJsonRpcParams
+	requestIndexes := map[int]int{}
+	for i, request := range requests {
+		jsonRpcParams := getJsonRpcParams(request.Method, request.Params)
+		requestIndexes[jsonRpcParams.Id] = i
+		batchParams = append(batchParams, jsonRpcParams)
+		methods = append(methods, request.Method)
+	}
+
+	response, err := rpc.getWebClient(methods...).Post(ctx, rpc.ApiUrl, rpc.AccessToken, batchParams)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	var rpcResponses []*rpcResponse
+	err = json.Unmarshal(response, &rpcResponses)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	answered := map[int]bool{}
+	for _, rpcResponse := range rpcResponses {
+		i, ok := requestIndexes[rpcResponse.Id]
+		if !ok {
+			continue
+		}
+
+		answered[i] = true
+		requests[i].Error = rpc.decodeResponse(requests[i].Method, rpcResponse, requests[i].Result)
+	}
+
+	for i, request := range requests {
+		if !answered[i] {
+			request.Error = fmt.Errorf("%s: no response in batch from %s", request.Method, rpc.ApiUrl)
+		}
+	}
+
+	return nil
+}
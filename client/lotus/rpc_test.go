@@ -0,0 +1,120 @@
+package lotus
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+const (
+	testMethodEcho    = "Filecoin.TestEcho"
+	testMethodFail    = "Filecoin.TestFail"
+	testMethodNull    = "Filecoin.TestNull"
+	testMethodMissing = "Filecoin.TestMissing"
+)
+
+//answers a json-rpc batch in reverse order with an extra response of an unknown id,
+//echo methods return their first param, fail methods an error, null methods null,
+//missing methods are not answered
+func getBatchServer(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		var batchParams []LotusJsonRpcParams
+		err := json.NewDecoder(request.Body).Decode(&batchParams)
+		if err != nil {
+			t.Errorf("decode batch: %v", err)
+			writer.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		responses := []map[string]interface{}{
+			{"jsonrpc": LOTUS_JSON_RPC_VERSION, "id": -1, "result": "unknown"},
+		}
+		for i := len(batchParams) - 1; i >= 0; i-- {
+			params := batchParams[i]
+			response := map[string]interface{}{"jsonrpc": LOTUS_JSON_RPC_VERSION, "id": params.Id}
+			switch params.Method {
+			case testMethodEcho:
+				response["result"] = params.Params[0]
+			case testMethodFail:
+				response["error"] = JsonRpcError{Code: 1, Message: "failed"}
+			case testMethodNull:
+				response["result"] = nil
+			case testMethodMissing:
+				continue
+			}
+			responses = append(responses, response)
+		}
+
+		json.NewEncoder(writer).Encode(responses)
+	}))
+}
+
+func TestRPCCallBatch(t *testing.T) {
+	server := getBatchServer(t)
+	defer server.Close()
+
+	rpc := GetRPC(server.URL, "", nil)
+
+	tests := []struct {
+		name    string
+		methods []string
+		params  []string
+	}{
+		{"single", []string{testMethodEcho}, []string{"a"}},
+		{"results matched by id", []string{testMethodEcho, testMethodEcho, testMethodEcho}, []string{"a", "b", "c"}},
+		{"mixed", []string{testMethodEcho, testMethodFail, testMethodEcho, testMethodNull, testMethodMissing, testMethodEcho}, []string{"a", "b", "c", "d", "e", "f"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var requests []*RpcRequest
+			for i, method := range test.methods {
+				var result string
+				requests = append(requests, &RpcRequest{
+					Method: method,
+					Params: []interface{}{test.params[i]},
+					Result: &result,
+				})
+			}
+
+			err := rpc.CallBatch(context.Background(), requests)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for i, request := range requests {
+				result := *request.Result.(*string)
+				switch request.Method {
+				case testMethodEcho:
+					if request.Error != nil || result != test.params[i] {
+						t.Errorf("request %d: result = %q, error = %v, want %q", i, result, request.Error, test.params[i])
+					}
+				case testMethodFail:
+					var rpcError *RpcError
+					if !errors.As(request.Error, &rpcError) || rpcError.Method != testMethodFail || rpcError.Message != "failed" {
+						t.Errorf("request %d: error = %v, want RpcError of %s", i, request.Error, testMethodFail)
+					}
+				case testMethodNull:
+					if !errors.Is(request.Error, ErrEmptyResult) {
+						t.Errorf("request %d: error = %v, want ErrEmptyResult", i, request.Error)
+					}
+				case testMethodMissing:
+					if request.Error == nil {
+						t.Errorf("request %d: error = nil, want no response error", i)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestRPCCallBatchNoRequest(t *testing.T) {
+	rpc := GetRPC("", "", nil)
+	err := rpc.CallBatch(context.Background(), nil)
+	if err != nil {
+		t.Errorf("error = %v, want nil", err)
+	}
+}
@@ -0,0 +1,251 @@
+package lotus
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/filswan/go-swan-lib/logs"
+	"github.com/filswan/go-swan-lib/model"
+)
+
+const (
+	START_DEALS_CONCURRENCY_PER_MINER_DEFAULT = 2
+	START_DEALS_QUERY_ASK_CONCURRENCY         = 8
+)
+
+type StartDealsOptions struct {
+	MaxConcurrentPerMiner int          // proposals sent to one miner at the same time, 0 means START_DEALS_CONCURRENCY_PER_MINER_DEFAULT
+	MaxConcurrent         int          // proposals sent at the same time in total, 0 means no limit other than the per miner one
+	AllOrNothing          bool         // when true, no deal is sent if any deal config is invalid
+	Confirmer             Confirmer    // asked before each deal is sent, one deal at a time, nil means no confirmation
+	BudgetGuard           *BudgetGuard // when set, the batch is refused if it exceeds the budget of any wallet
+}
+
+//DealCid is set when the deal is sent, otherwise Err is a *DealError
+type StartDealResult struct {
+	DealConfig model.DealConfig
+	DealCid    string
+	Err        error
+}
+
+type dealProposal struct {
+	index       int
+	dealConfig  model.DealConfig
+	dealSummary *DealSummary
+}
+
+//sends the deals without any confirmation, SkipConfirmation of each deal config is ignored,
+//results are in the same order as dealConfigs, the returned error is for the whole batch,
+//such as the current epoch cannot be got
+func (lotusClient *LotusClient) StartDeals(ctx context.Context, dealConfigs []model.DealConfig, opts *StartDealsOptions) ([]StartDealResult, error) {
+	if opts == nil {
+		opts = &StartDealsOptions{}
+	}
+
+	results := make([]StartDealResult, len(dealConfigs))
+	for i, dealConfig := range dealConfigs {
+		results[i].DealConfig = dealConfig
+	}
+
+	if len(dealConfigs) == 0 {
+		return results, nil
+	}
+
+	currentEpoch, err := lotusClient.LotusGetCurrentEpoch()
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	minerConfigs := lotusClient.queryAsks(ctx, dealConfigs)
+
+	var validatedDeals []dealProposal
+	for i := range results {
+		dealConfig := &results[i].DealConfig
+		minerConfig := minerConfigs[dealConfig.MinerFid]
+		if minerConfig.err != nil {
+			results[i].Err = getDealError(DEAL_STAGE_QUERY_ASK, dealConfig, minerConfig.err)
+			continue
+		}
+
+		minerPrice, err := checkDealConfig(dealConfig, minerConfig.minerConfig, *currentEpoch)
+		if err != nil {
+			results[i].Err = getDealError(DEAL_STAGE_VALIDATE, dealConfig, err)
+			continue
+		}
+
+		validatedDeals = append(validatedDeals, dealProposal{
+			index:       i,
+			dealConfig:  *dealConfig,
+			dealSummary: GetDealSummary(dealConfig, *minerPrice),
+		})
+	}
+
+	if opts.AllOrNothing && len(validatedDeals) < len(dealConfigs) {
+		err := fmt.Errorf("%d of %d deal configs are invalid, no deal is sent", len(dealConfigs)-len(validatedDeals), len(dealConfigs))
+		logs.GetLogger().Error(err)
+		for _, validatedDeal := range validatedDeals {
+			results[validatedDeal.index].Err = getDealError(DEAL_STAGE_VALIDATE, &validatedDeal.dealConfig, err)
+		}
+		return results, nil
+	}
+
+	if opts.BudgetGuard != nil {
+		var dealSummaries []*DealSummary
+		for _, validatedDeal := range validatedDeals {
+			dealSummaries = append(dealSummaries, validatedDeal.dealSummary)
+		}
+
+		err := opts.BudgetGuard.Reserve(dealSummaries)
+		if err != nil {
+			logs.GetLogger().Error(err)
+			for _, validatedDeal := range validatedDeals {
+				results[validatedDeal.index].Err = getDealError(DEAL_STAGE_BUDGET, &validatedDeal.dealConfig, err)
+			}
+			return results, nil
+		}
+	}
+
+	lotusClient.sendDeals(ctx, validatedDeals, results, opts)
+
+	return results, nil
+}
+
+type minerAsk struct {
+	minerConfig *MinerConfig
+	err         error
+}
+
+//queries the ask of each miner once
+func (lotusClient *LotusClient) queryAsks(ctx context.Context, dealConfigs []model.DealConfig) map[string]*minerAsk {
+	minerAsks := map[string]*minerAsk{}
+	for _, dealConfig := range dealConfigs {
+		minerAsks[dealConfig.MinerFid] = &minerAsk{}
+	}
+
+	var wg sync.WaitGroup
+	semaphore := make(chan struct{}, START_DEALS_QUERY_ASK_CONCURRENCY)
+	for minerFid, ask := range minerAsks {
+		wg.Add(1)
+		go func(minerFid string, ask *minerAsk) {
+			defer wg.Done()
+
+			select {
+			case semaphore <- struct{}{}:
+				defer func() { <-semaphore }()
+			case <-ctx.Done():
+				ask.err = ctx.Err()
+				return
+			}
+
+			ask.minerConfig, ask.err = lotusClient.queryAsk(ctx, minerFid)
+		}(minerFid, ask)
+	}
+	wg.Wait()
+
+	return minerAsks
+}
+
+func (lotusClient *LotusClient) sendDeals(ctx context.Context, validatedDeals []dealProposal, results []StartDealResult, opts *StartDealsOptions) {
+	maxConcurrentPerMiner := opts.MaxConcurrentPerMiner
+	if maxConcurrentPerMiner <= 0 {
+		maxConcurrentPerMiner = START_DEALS_CONCURRENCY_PER_MINER_DEFAULT
+	}
+
+	minerSemaphores := map[string]chan struct{}{}
+	for _, validatedDeal := range validatedDeals {
+		minerFid := validatedDeal.dealConfig.MinerFid
+		if _, ok := minerSemaphores[minerFid]; !ok {
+			minerSemaphores[minerFid] = make(chan struct{}, maxConcurrentPerMiner)
+		}
+	}
+
+	var semaphore chan struct{}
+	if opts.MaxConcurrent > 0 {
+		semaphore = make(chan struct{}, opts.MaxConcurrent)
+	}
+
+	var confirmMutex sync.Mutex
+	var wg sync.WaitGroup
+	for _, validatedDeal := range validatedDeals {
+		wg.Add(1)
+		go func(validatedDeal dealProposal) {
+			defer wg.Done()
+
+			result := &results[validatedDeal.index]
+			dealConfig := &validatedDeal.dealConfig
+			defer func() {
+				if result.Err != nil && opts.BudgetGuard != nil {
+					opts.BudgetGuard.Release(validatedDeal.dealSummary)
+				}
+			}()
+
+			if opts.Confirmer != nil {
+				confirmMutex.Lock()
+				confirmed, err := opts.Confirmer.Confirm(validatedDeal.dealSummary)
+				confirmMutex.Unlock()
+				if err == nil && !confirmed {
+					err = ErrDealNotConfirmed
+				}
+				if err != nil {
+					result.Err = getDealError(DEAL_STAGE_CONFIRM, dealConfig, err)
+					return
+				}
+			}
+
+			release, err := acquire(ctx, minerSemaphores[dealConfig.MinerFid], semaphore)
+			if err != nil {
+				result.Err = getDealError(DEAL_STAGE_PROPOSE, dealConfig, err)
+				return
+			}
+			defer release()
+
+			dealCid, err := lotusClient.startDeal(ctx, dealConfig, validatedDeal.dealSummary)
+			if err != nil {
+				result.Err = getDealError(DEAL_STAGE_PROPOSE, dealConfig, err)
+				return
+			}
+
+			result.DealConfig = *dealConfig
+			result.DealCid = *dealCid
+			logs.GetLogger().Info("deal sent, miner:", dealConfig.MinerFid, ", payload cid:", dealConfig.PayloadCid, ", deal cid:", *dealCid)
+		}(validatedDeal)
+	}
+	wg.Wait()
+}
+
+//takes a slot from each non nil semaphore in order
+func acquire(ctx context.Context, semaphores ...chan struct{}) (func(), error) {
+	var acquired []chan struct{}
+	release := func() {
+		for _, semaphore := range acquired {
+			<-semaphore
+		}
+	}
+
+	for _, semaphore := range semaphores {
+		if semaphore == nil {
+			continue
+		}
+
+		select {
+		case semaphore <- struct{}{}:
+			acquired = append(acquired, semaphore)
+		case <-ctx.Done():
+			release()
+			return nil, ctx.Err()
+		}
+	}
+
+	return release, nil
+}
+
+func getDealError(stage string, dealConfig *model.DealConfig, err error) *DealError {
+	return &DealError{
+		Stage:      stage,
+		MinerFid:   dealConfig.MinerFid,
+		PayloadCid: dealConfig.PayloadCid,
+		Err:        err,
+	}
+}
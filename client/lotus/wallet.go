@@ -1,6 +1,7 @@
 package lotus
 
 import (
+	"errors"
 	"fmt"
 	"strings"
 
@@ -8,30 +9,45 @@ import (
 	"github.com/filswan/go-swan-lib/logs"
 )
 
-func IsWalletVerified(wallet string) (bool, error) {
+//printed by lotus-shed verifreg check-client for a wallet without datacap
+const LOTUS_SHED_OUTPUT_NOT_VERIFIED_CLIENT = "is not a verified client"
+
+//returns an error wrapping ErrWalletNotVerified when the wallet is not a verified client
+func CheckWalletVerified(wallet string) error {
 	wallet = strings.Trim(wallet, " ")
 	if wallet == "" {
 		err := fmt.Errorf("invalid wallet")
 		logs.GetLogger().Error(err)
-		return false, err
+		return err
 	}
 
 	cmd := "lotus-shed verifreg check-client " + wallet
 
 	result, err := client.ExecOsCmd(cmd, true)
-	if err != nil {
+	if err != nil && !strings.Contains(err.Error(), LOTUS_SHED_OUTPUT_NOT_VERIFIED_CLIENT) {
 		logs.GetLogger().Error(err)
+		return err
+	}
 
-		if strings.Contains(err.Error(), "is not a verified client") {
-			return false, nil
-		}
-
-		return false, err
+	if err != nil || strings.Contains(result, LOTUS_SHED_OUTPUT_NOT_VERIFIED_CLIENT) {
+		err := fmt.Errorf("wallet:%s, %w", wallet, ErrWalletNotVerified)
+		logs.GetLogger().Error(err)
+		return err
 	}
 
-	if strings.Contains(result, "is not a verified client") {
+	return nil
+}
+
+func IsWalletVerified(wallet string) (bool, error) {
+	err := CheckWalletVerified(wallet)
+	if errors.Is(err, ErrWalletNotVerified) {
 		return false, nil
 	}
 
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return false, err
+	}
+
 	return true, nil
 }
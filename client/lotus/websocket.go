@@ -0,0 +1,671 @@
+package lotus
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/filswan/go-swan-lib/client/web"
+	"github.com/filswan/go-swan-lib/logs"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	LOTUS_CHAIN_NOTIFY             = "Filecoin.ChainNotify"
+	LOTUS_CLIENT_GET_DEAL_UPDATES  = "Filecoin.ClientGetDealUpdates"
+	LOTUS_WS_CHANNEL_VALUE         = "xrpc.ch.val"
+	LOTUS_WS_CHANNEL_CLOSE         = "xrpc.ch.close"
+	LOTUS_WS_CANCEL                = "xrpc.cancel"
+	LOTUS_WS_SUBSCRIPTION_BUFFER   = 16
+	LOTUS_WS_SUBSCRIPTION_QUEUE    = 1024 // values queued for a subscriber not reading, later values are dropped
+	LOTUS_WS_HANDSHAKE_TIMEOUT_SEC = 30
+)
+
+var ErrConnectionClosed = errors.New("websocket connection closed")
+
+//implemented by RPC (http) and WsRPC (websocket)
+type RpcCaller interface {
+	Call(ctx context.Context, method string, result interface{}, params ...interface{}) error
+}
+
+//json-rpc over websocket, it reconnects when the connection is lost and then resubscribes all active subscriptions
+type WsRPC struct {
+	ApiUrl          string           // ws://[ip]:[port]/rpc/v0, http(s) urls are converted to ws(s)
+	AccessToken     string           // sent as bearer token when not empty
+	ReconnectPolicy *web.RetryPolicy // nil means no reconnection
+
+	conn          *websocket.Conn
+	writeMutex    sync.Mutex
+	mutex         sync.Mutex
+	pending       map[int]*wsPendingRequest
+	subscriptions map[*wsSubscription]bool
+	channels      map[int]*wsSubscription // server side channel id to subscription
+	closed        chan struct{}
+	closeOnce     sync.Once
+}
+
+type wsMessage struct {
+	Id      *int            `json:"id,omitempty"`
+	JsonRpc string          `json:"jsonrpc"`
+	Method  string          `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *JsonRpcError   `json:"error,omitempty"`
+}
+
+type wsPendingRequest struct {
+	response     chan *wsMessage
+	subscription *wsSubscription // set for subscribe requests, the channel is registered as soon as the response is read
+}
+
+type wsSubscription struct {
+	ctx        context.Context
+	method     string
+	params     []interface{}
+	values     chan json.RawMessage
+	channelId  int
+	requestId  int // of the request which opened the server side channel, cancelled when ctx is done
+	done       chan struct{}
+	closeOnce  sync.Once
+	queue      []json.RawMessage // filled by the reader, emptied into values by deliver
+	queueMutex sync.Mutex
+	queued     chan struct{}
+}
+
+type HeadChange struct {
+	Type string
+	Val  *TipSet
+}
+
+type TipSet struct {
+	Cids   []Cid
+	Height int64
+}
+
+type ClientDealUpdate struct {
+	ProposalCid   Cid
+	State         StorageDealStatus
+	Message       string
+	Provider      string
+	PieceCID      Cid
+	Size          int64
+	PricePerEpoch string
+	Duration      int64
+	DealID        int64
+	Verified      bool
+}
+
+//connects to the lotus websocket api, the connection lives until Close is called
+func GetWsRPC(ctx context.Context, apiUrl, accessToken string, reconnectPolicy *web.RetryPolicy) (*WsRPC, error) {
+	if len(apiUrl) == 0 {
+		err := fmt.Errorf("lotus api url is required")
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	wsRpc := &WsRPC{
+		ApiUrl:          getWsUrl(apiUrl),
+		AccessToken:     accessToken,
+		ReconnectPolicy: reconnectPolicy,
+		pending:         map[int]*wsPendingRequest{},
+		subscriptions:   map[*wsSubscription]bool{},
+		channels:        map[int]*wsSubscription{},
+		closed:          make(chan struct{}),
+	}
+
+	conn, err := wsRpc.dial(ctx)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	wsRpc.conn = conn
+	go wsRpc.run(conn)
+
+	return wsRpc, nil
+}
+
+func getWsUrl(apiUrl string) string {
+	if strings.HasPrefix(apiUrl, "http://") {
+		return "ws://" + strings.TrimPrefix(apiUrl, "http://")
+	}
+
+	if strings.HasPrefix(apiUrl, "https://") {
+		return "wss://" + strings.TrimPrefix(apiUrl, "https://")
+	}
+
+	return apiUrl
+}
+
+func (wsRpc *WsRPC) dial(ctx context.Context) (*websocket.Conn, error) {
+	header := http.Header{}
+	if len(strings.Trim(wsRpc.AccessToken, " ")) > 0 {
+		header.Set("Authorization", "Bearer "+wsRpc.AccessToken)
+	}
+
+	dialer := &websocket.Dialer{
+		Proxy:            http.ProxyFromEnvironment,
+		HandshakeTimeout: LOTUS_WS_HANDSHAKE_TIMEOUT_SEC * time.Second,
+	}
+
+	conn, response, err := dialer.DialContext(ctx, wsRpc.ApiUrl, header)
+	if err != nil {
+		if response != nil {
+			err = &web.HTTPStatusError{
+				StatusCode: response.StatusCode,
+				Status:     response.Status,
+				Url:        wsRpc.ApiUrl,
+			}
+		}
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	return conn, nil
+}
+
+func (wsRpc *WsRPC) isClosed() bool {
+	select {
+	case <-wsRpc.closed:
+		return true
+	default:
+		return false
+	}
+}
+
+func (wsRpc *WsRPC) Close() error {
+	var err error
+	wsRpc.closeOnce.Do(func() {
+		close(wsRpc.closed)
+
+		wsRpc.mutex.Lock()
+		conn := wsRpc.conn
+		wsRpc.mutex.Unlock()
+
+		if conn != nil {
+			err = conn.Close()
+		}
+	})
+
+	return err
+}
+
+//reads messages until the connection is closed, then reconnects when a reconnect policy is set
+func (wsRpc *WsRPC) run(conn *websocket.Conn) {
+	for {
+		err := wsRpc.readMessages(conn)
+		wsRpc.failPending(err)
+		if wsRpc.isClosed() {
+			wsRpc.closeSubscriptions()
+			return
+		}
+
+		logs.GetLogger().Error("lotus websocket connection lost:", err)
+		conn, err = wsRpc.reconnect()
+		if err != nil {
+			logs.GetLogger().Error(err)
+			wsRpc.Close()
+			wsRpc.closeSubscriptions()
+			return
+		}
+
+		go wsRpc.resubscribe()
+	}
+}
+
+func (wsRpc *WsRPC) readMessages(conn *websocket.Conn) error {
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return err
+		}
+
+		message := &wsMessage{}
+		err = json.Unmarshal(data, message)
+		if err != nil {
+			logs.GetLogger().Error(err)
+			continue
+		}
+
+		if message.Method != "" {
+			wsRpc.handleNotification(message)
+			continue
+		}
+
+		if message.Id == nil {
+			continue
+		}
+
+		wsRpc.mutex.Lock()
+		pendingRequest, ok := wsRpc.pending[*message.Id]
+		delete(wsRpc.pending, *message.Id)
+		if ok && pendingRequest.subscription != nil && message.Error == nil {
+			pendingRequest.subscription.requestId = *message.Id
+			var channelId int
+			if json.Unmarshal(message.Result, &channelId) == nil {
+				pendingRequest.subscription.channelId = channelId
+				wsRpc.channels[channelId] = pendingRequest.subscription
+			}
+		}
+		wsRpc.mutex.Unlock()
+
+		if ok {
+			pendingRequest.response <- message
+		}
+	}
+}
+
+func (wsRpc *WsRPC) handleNotification(message *wsMessage) {
+	var params []json.RawMessage
+	err := json.Unmarshal(message.Params, &params)
+	if err != nil || len(params) == 0 {
+		logs.GetLogger().Error("invalid params in ", message.Method)
+		return
+	}
+
+	var channelId int
+	err = json.Unmarshal(params[0], &channelId)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return
+	}
+
+	wsRpc.mutex.Lock()
+	subscription := wsRpc.channels[channelId]
+	if message.Method == LOTUS_WS_CHANNEL_CLOSE {
+		delete(wsRpc.channels, channelId)
+		delete(wsRpc.subscriptions, subscription)
+	}
+	wsRpc.mutex.Unlock()
+
+	if subscription == nil {
+		return
+	}
+
+	switch message.Method {
+	case LOTUS_WS_CHANNEL_VALUE:
+		if len(params) < 2 {
+			return
+		}
+		subscription.send(params[1])
+	case LOTUS_WS_CHANNEL_CLOSE:
+		subscription.close()
+	}
+}
+
+func (wsRpc *WsRPC) failPending(err error) {
+	wsRpc.mutex.Lock()
+	defer wsRpc.mutex.Unlock()
+
+	if err == nil {
+		err = ErrConnectionClosed
+	}
+
+	for id, pendingRequest := range wsRpc.pending {
+		pendingRequest.response <- &wsMessage{Error: &JsonRpcError{Code: -1, Message: fmt.Sprintf("%s: %s", ErrConnectionClosed, err)}}
+		delete(wsRpc.pending, id)
+	}
+
+	for channelId := range wsRpc.channels {
+		delete(wsRpc.channels, channelId)
+	}
+
+	wsRpc.conn = nil
+}
+
+func (wsRpc *WsRPC) reconnect() (*websocket.Conn, error) {
+	if wsRpc.ReconnectPolicy == nil {
+		return nil, ErrConnectionClosed
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-wsRpc.closed:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	reconnectPolicy := *wsRpc.ReconnectPolicy
+	reconnectPolicy.IsRetryable = func(err error) bool {
+		return true
+	}
+
+	var conn *websocket.Conn
+	err := reconnectPolicy.Do(ctx, func() error {
+		var err error
+		conn, err = wsRpc.dial(ctx)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	wsRpc.mutex.Lock()
+	wsRpc.conn = conn
+	wsRpc.mutex.Unlock()
+
+	if wsRpc.isClosed() {
+		conn.Close()
+		return nil, ErrConnectionClosed
+	}
+
+	logs.GetLogger().Info("lotus websocket reconnected to ", wsRpc.ApiUrl)
+	return conn, nil
+}
+
+func (wsRpc *WsRPC) resubscribe() {
+	wsRpc.mutex.Lock()
+	var subscriptions []*wsSubscription
+	for subscription := range wsRpc.subscriptions {
+		subscriptions = append(subscriptions, subscription)
+	}
+	wsRpc.mutex.Unlock()
+
+	for _, subscription := range subscriptions {
+		err := wsRpc.subscribe(subscription)
+		if err != nil {
+			logs.GetLogger().Error("failed to resubscribe ", subscription.method, ":", err)
+			wsRpc.removeSubscription(subscription)
+		}
+	}
+}
+
+func (wsRpc *WsRPC) closeSubscriptions() {
+	wsRpc.mutex.Lock()
+	var subscriptions []*wsSubscription
+	for subscription := range wsRpc.subscriptions {
+		subscriptions = append(subscriptions, subscription)
+	}
+	wsRpc.subscriptions = map[*wsSubscription]bool{}
+	wsRpc.mutex.Unlock()
+
+	for _, subscription := range subscriptions {
+		subscription.close()
+	}
+}
+
+func (wsRpc *WsRPC) removeSubscription(subscription *wsSubscription) {
+	wsRpc.mutex.Lock()
+	delete(wsRpc.subscriptions, subscription)
+	if wsRpc.channels[subscription.channelId] == subscription {
+		delete(wsRpc.channels, subscription.channelId)
+	}
+	wsRpc.mutex.Unlock()
+
+	subscription.close()
+}
+
+//asks the node to close the channel of the subscription, then removes it
+func (wsRpc *WsRPC) cancelSubscription(subscription *wsSubscription) {
+	wsRpc.mutex.Lock()
+	requestId := subscription.requestId
+	active := wsRpc.channels[subscription.channelId] == subscription
+	wsRpc.mutex.Unlock()
+
+	if active {
+		err := wsRpc.send(getJsonRpcParams(LOTUS_WS_CANCEL, []interface{}{requestId}))
+		if err != nil {
+			logs.GetLogger().Error(err)
+		}
+	}
+
+	wsRpc.removeSubscription(subscription)
+}
+
+//queues the value without blocking the reader, so a slow subscriber does not delay the others
+func (subscription *wsSubscription) send(value json.RawMessage) {
+	subscription.queueMutex.Lock()
+	if len(subscription.queue) >= LOTUS_WS_SUBSCRIPTION_QUEUE {
+		subscription.queueMutex.Unlock()
+		logs.GetLogger().Warn(subscription.method, " subscriber is not reading, value dropped")
+		return
+	}
+	subscription.queue = append(subscription.queue, value)
+	subscription.queueMutex.Unlock()
+
+	select {
+	case subscription.queued <- struct{}{}:
+	default:
+	}
+}
+
+func (subscription *wsSubscription) takeQueue() []json.RawMessage {
+	subscription.queueMutex.Lock()
+	defer subscription.queueMutex.Unlock()
+
+	queue := subscription.queue
+	subscription.queue = nil
+	return queue
+}
+
+//moves the queued values to values until the subscription is closed, then closes values,
+//values still queued then are delivered only when there is room in values
+func (subscription *wsSubscription) deliver() {
+	defer close(subscription.values)
+
+	for {
+		select {
+		case <-subscription.queued:
+		case <-subscription.done:
+			for _, value := range subscription.takeQueue() {
+				select {
+				case subscription.values <- value:
+				default:
+				}
+			}
+			return
+		}
+
+		for _, value := range subscription.takeQueue() {
+			select {
+			case subscription.values <- value:
+			case <-subscription.done:
+				return
+			case <-subscription.ctx.Done():
+				return
+			}
+		}
+	}
+}
+
+func (subscription *wsSubscription) close() {
+	subscription.closeOnce.Do(func() {
+		close(subscription.done)
+	})
+}
+
+func (wsRpc *WsRPC) send(jsonRpcParams interface{}) error {
+	wsRpc.mutex.Lock()
+	conn := wsRpc.conn
+	wsRpc.mutex.Unlock()
+
+	if conn == nil {
+		return ErrConnectionClosed
+	}
+
+	wsRpc.writeMutex.Lock()
+	defer wsRpc.writeMutex.Unlock()
+
+	return conn.WriteJSON(jsonRpcParams)
+}
+
+//sends the request and waits for its response, the request is cancelled on the node when ctx is done
+func (wsRpc *WsRPC) request(ctx context.Context, method string, params []interface{}, subscription *wsSubscription) (*wsMessage, error) {
+	if wsRpc.isClosed() {
+		return nil, ErrConnectionClosed
+	}
+
+	jsonRpcParams := getJsonRpcParams(method, params)
+	pendingRequest := &wsPendingRequest{
+		response:     make(chan *wsMessage, 1),
+		subscription: subscription,
+	}
+
+	wsRpc.mutex.Lock()
+	wsRpc.pending[jsonRpcParams.Id] = pendingRequest
+	wsRpc.mutex.Unlock()
+
+	err := wsRpc.send(jsonRpcParams)
+	if err != nil {
+		wsRpc.mutex.Lock()
+		delete(wsRpc.pending, jsonRpcParams.Id)
+		wsRpc.mutex.Unlock()
+		return nil, err
+	}
+
+	select {
+	case response := <-pendingRequest.response:
+		return response, nil
+	case <-ctx.Done():
+		wsRpc.mutex.Lock()
+		delete(wsRpc.pending, jsonRpcParams.Id)
+		wsRpc.mutex.Unlock()
+		wsRpc.send(getJsonRpcParams(LOTUS_WS_CANCEL, []interface{}{jsonRpcParams.Id}))
+		return nil, ctx.Err()
+	case <-wsRpc.closed:
+		return nil, ErrConnectionClosed
+	}
+}
+
+func (wsRpc *WsRPC) Call(ctx context.Context, method string, result interface{}, params ...interface{}) error {
+	response, err := wsRpc.request(ctx, method, params, nil)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	rpcResponse := &rpcResponse{
+		Result: response.Result,
+		Error:  response.Error,
+	}
+
+	rpc := &RPC{ApiUrl: wsRpc.ApiUrl}
+	err = rpc.decodeResponse(method, rpcResponse, result)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	return nil
+}
+
+func (wsRpc *WsRPC) subscribe(subscription *wsSubscription) error {
+	response, err := wsRpc.request(subscription.ctx, subscription.method, subscription.params, subscription)
+	if err != nil {
+		return err
+	}
+
+	if response.Error != nil {
+		return newRpcError(subscription.method, response.Error)
+	}
+
+	var channelId int
+	err = json.Unmarshal(response.Result, &channelId)
+	if err != nil {
+		return fmt.Errorf("%s: invalid channel id, %w", subscription.method, err)
+	}
+
+	return nil
+}
+
+//calls a lotus method returning a channel, values are delivered until ctx is done,
+//the node closes the channel, or the connection is closed and cannot be restored,
+//the returned channel is closed then, values are queued for a slow subscriber up to LOTUS_WS_SUBSCRIPTION_QUEUE
+func (wsRpc *WsRPC) Subscribe(ctx context.Context, method string, params ...interface{}) (<-chan json.RawMessage, error) {
+	subscription := &wsSubscription{
+		ctx:    ctx,
+		method: method,
+		params: params,
+		values: make(chan json.RawMessage, LOTUS_WS_SUBSCRIPTION_BUFFER),
+		done:   make(chan struct{}),
+		queued: make(chan struct{}, 1),
+	}
+	go subscription.deliver()
+
+	wsRpc.mutex.Lock()
+	wsRpc.subscriptions[subscription] = true
+	wsRpc.mutex.Unlock()
+
+	err := wsRpc.subscribe(subscription)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		wsRpc.removeSubscription(subscription)
+		return nil, err
+	}
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			wsRpc.cancelSubscription(subscription)
+		case <-wsRpc.closed:
+		}
+	}()
+
+	return subscription.values, nil
+}
+
+func (wsRpc *WsRPC) ChainNotify(ctx context.Context) (<-chan []HeadChange, error) {
+	values, err := wsRpc.Subscribe(ctx, LOTUS_CHAIN_NOTIFY)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	headChangesCh := make(chan []HeadChange, LOTUS_WS_SUBSCRIPTION_BUFFER)
+	go func() {
+		defer close(headChangesCh)
+		for value := range values {
+			var headChanges []HeadChange
+			err := json.Unmarshal(value, &headChanges)
+			if err != nil {
+				logs.GetLogger().Error(err)
+				continue
+			}
+
+			select {
+			case headChangesCh <- headChanges:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return headChangesCh, nil
+}
+
+func (wsRpc *WsRPC) ClientGetDealUpdates(ctx context.Context) (<-chan ClientDealUpdate, error) {
+	values, err := wsRpc.Subscribe(ctx, LOTUS_CLIENT_GET_DEAL_UPDATES)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	dealUpdatesCh := make(chan ClientDealUpdate, LOTUS_WS_SUBSCRIPTION_BUFFER)
+	go func() {
+		defer close(dealUpdatesCh)
+		for value := range values {
+			var dealUpdate ClientDealUpdate
+			err := json.Unmarshal(value, &dealUpdate)
+			if err != nil {
+				logs.GetLogger().Error(err)
+				continue
+			}
+
+			select {
+			case dealUpdatesCh <- dealUpdate:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return dealUpdatesCh, nil
+}
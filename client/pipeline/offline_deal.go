@@ -0,0 +1,451 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/filswan/go-swan-lib/car"
+	"github.com/filswan/go-swan-lib/client"
+	"github.com/filswan/go-swan-lib/client/swan"
+	"github.com/filswan/go-swan-lib/constants"
+	"github.com/filswan/go-swan-lib/logs"
+	"github.com/filswan/go-swan-lib/model"
+	"github.com/filswan/go-swan-lib/utils"
+)
+
+const (
+	OFFLINE_DEAL_PIPELINE_CONCURRENCY_DEFAULT   = 3
+	OFFLINE_DEAL_PIPELINE_POLL_INTERVAL_DEFAULT = 10 * time.Second
+)
+
+var ErrNothingToVerify = errors.New("neither car file size nor md5 to verify the car file against")
+
+//implemented by *swan.SwanClient
+type OfflineDealSource interface {
+	GetOfflineDealsByStatus(params swan.GetOfflineDealsByStatusParams) ([]*model.OfflineDeal, error)
+	UpdateOfflineDeal(params swan.UpdateOfflineDealParams) error
+	GetCarFileByUuidUrl(taskUuid, carFileUrl string) (*swan.GetCarFileByUuidUrlResultData, error)
+}
+
+//implemented by *client.Aria2Client
+type Downloader interface {
+	AddUri(ctx context.Context, uris []string, aria2DownloadOption *client.Aria2DownloadOption) (string, error)
+	TellStatus(ctx context.Context, gid string, keys ...string) (*client.Aria2StatusResult, error)
+	Remove(ctx context.Context, gid string, force bool) (string, error)
+}
+
+//implemented by *lotus.LotusMarket
+type DataImporter interface {
+	LotusImportData(dealCid string, filepath string) error
+}
+
+//called after each status reported to swan, note is empty unless the deal failed
+type OfflineDealStatusFunc func(offlineDeal *model.OfflineDeal, status, note string)
+
+//downloads the car files of the offline deals of a miner, verifies and imports them,
+//each status change is reported to swan: Downloading, Downloaded or DownloadFailed, FileImporting, FileImported or ImportFailed
+type OfflineDealPipeline struct {
+	Source      OfflineDealSource
+	Downloader  Downloader
+	Importer    DataImporter
+	MinerFid    string
+	DownloadDir string
+
+	Concurrency    int                   // deals processed at once, OFFLINE_DEAL_PIPELINE_CONCURRENCY_DEFAULT when 0
+	PageSize       int                   // deals fetched by Run, swan.GET_OFFLINEDEAL_LIMIT_DEFAULT when 0
+	PollInterval   time.Duration         // of the download status, OFFLINE_DEAL_PIPELINE_POLL_INTERVAL_DEFAULT when 0
+	DownloadHeader []string              // sent with each download, such as "Authorization: Bearer [token]"
+	VerifyCarFile  bool                  // also read the car file and check its blocks and root, see car.VerifyOfflineDealCarFile, required when swan has neither the size nor the md5 of the car file
+	OnStatus       OfflineDealStatusFunc // optional
+}
+
+type OfflineDealResult struct {
+	OfflineDeal *model.OfflineDeal
+	Status      string // last status reported to swan
+	Error       error
+}
+
+func GetOfflineDealPipeline(source OfflineDealSource, downloader Downloader, importer DataImporter, minerFid, downloadDir string) *OfflineDealPipeline {
+	offlineDealPipeline := &OfflineDealPipeline{
+		Source:      source,
+		Downloader:  downloader,
+		Importer:    importer,
+		MinerFid:    minerFid,
+		DownloadDir: downloadDir,
+	}
+
+	return offlineDealPipeline
+}
+
+//processes the Created deals of the miner until there is none left, the returned error is for fetching the deals only,
+//the error of each deal is in its result, each deal is processed once, those left Created are not fetched again
+func (pipeline *OfflineDealPipeline) Run(ctx context.Context) ([]*OfflineDealResult, error) {
+	pageSize := pipeline.PageSize
+	if pageSize <= 0 {
+		pageSize = swan.GET_OFFLINEDEAL_LIMIT_DEFAULT
+	}
+
+	pageNum := swan.OFFLINE_DEAL_PAGE_NUM_FIRST
+	params := swan.GetOfflineDealsByStatusParams{
+		DealStatus: constants.OFFLINE_DEAL_STATUS_CREATED,
+		ForMiner:   true,
+		MinerFid:   &pipeline.MinerFid,
+		PageNum:    &pageNum,
+		PageSize:   &pageSize,
+	}
+
+	results := []*OfflineDealResult{}
+	processedDealIds := map[int]bool{}
+	var skippedPage []*model.OfflineDeal
+	for {
+		if ctx.Err() != nil {
+			return results, ctx.Err()
+		}
+
+		offlineDeals, err := pipeline.Source.GetOfflineDealsByStatus(params)
+		if err != nil {
+			logs.GetLogger().Error(err)
+			return results, err
+		}
+
+		newOfflineDeals := []*model.OfflineDeal{}
+		for _, offlineDeal := range offlineDeals {
+			if !processedDealIds[offlineDeal.Id] {
+				processedDealIds[offlineDeal.Id] = true
+				newOfflineDeals = append(newOfflineDeals, offlineDeal)
+			}
+		}
+
+		//processed deals usually leave Created, then the deals of the next pages move up to this page
+		if len(newOfflineDeals) > 0 {
+			results = append(results, pipeline.ProcessDeals(ctx, newOfflineDeals)...)
+			continue
+		}
+
+		//a short page is the last one, the same page again means swan does not page
+		if len(offlineDeals) < pageSize || isSameOfflineDeals(offlineDeals, skippedPage) {
+			return results, nil
+		}
+
+		//the page is full of deals left Created, such as the deals with nothing to verify
+		skippedPage = offlineDeals
+		pageNum++
+	}
+}
+
+func isSameOfflineDeals(offlineDeals, otherOfflineDeals []*model.OfflineDeal) bool {
+	if len(offlineDeals) != len(otherOfflineDeals) {
+		return false
+	}
+
+	for i := range offlineDeals {
+		if offlineDeals[i].Id != otherOfflineDeals[i].Id {
+			return false
+		}
+	}
+
+	return true
+}
+
+//processes the deals with at most Concurrency of them at once, the results are in the order of the deals
+func (pipeline *OfflineDealPipeline) ProcessDeals(ctx context.Context, offlineDeals []*model.OfflineDeal) []*OfflineDealResult {
+	concurrency := pipeline.Concurrency
+	if concurrency <= 0 {
+		concurrency = OFFLINE_DEAL_PIPELINE_CONCURRENCY_DEFAULT
+	}
+
+	results := make([]*OfflineDealResult, len(offlineDeals))
+	semaphore := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, offlineDeal := range offlineDeals {
+		semaphore <- struct{}{}
+		wg.Add(1)
+		go func(i int, offlineDeal *model.OfflineDeal) {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+
+			status, err := pipeline.ProcessDeal(ctx, offlineDeal)
+			results[i] = &OfflineDealResult{
+				OfflineDeal: offlineDeal,
+				Status:      status,
+				Error:       err,
+			}
+		}(i, offlineDeal)
+	}
+	wg.Wait()
+
+	return results
+}
+
+//downloads, verifies and imports the car file of the deal, returns the last status reported to swan,
+//a car file already downloaded is not downloaded again when it passes the verification,
+//the deal is left as is with ErrNothingToVerify when there is nothing to verify the car file against
+func (pipeline *OfflineDealPipeline) ProcessDeal(ctx context.Context, offlineDeal *model.OfflineDeal) (string, error) {
+	if ctx.Err() != nil {
+		return offlineDeal.Status, ctx.Err()
+	}
+
+	carFileMd5, err := pipeline.GetCarFileMd5(offlineDeal)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return offlineDeal.Status, err
+	}
+
+	if offlineDeal.CarFileSize <= 0 && carFileMd5 == "" && !pipeline.VerifyCarFile {
+		err := fmt.Errorf("deal cid:%s, %w", offlineDeal.DealCid, ErrNothingToVerify)
+		logs.GetLogger().Error(err)
+		return offlineDeal.Status, err
+	}
+
+	carFilePath := pipeline.GetCarFilePath(offlineDeal)
+	downloaded := false
+	if utils.IsFileExistsFullPath(carFilePath) {
+		offlineDeal.FilePath = carFilePath
+		downloaded = pipeline.Verify(offlineDeal, carFileMd5) == nil
+		if downloaded {
+			logs.GetLogger().Info("deal cid:", offlineDeal.DealCid, ", ", carFilePath, " already downloaded")
+		}
+	}
+
+	if !downloaded {
+		err = pipeline.updateStatus(offlineDeal, constants.OFFLINE_DEAL_STATUS_DOWNLOADING, "")
+		if err != nil {
+			logs.GetLogger().Error(err)
+			return offlineDeal.Status, err
+		}
+
+		offlineDeal.FilePath, err = pipeline.Download(ctx, offlineDeal)
+		if err == nil {
+			err = pipeline.Verify(offlineDeal, carFileMd5)
+		}
+		if err != nil {
+			err = pipeline.reportFailure(offlineDeal, constants.OFFLINE_DEAL_STATUS_DOWNLOAD_FAILED, err)
+			return offlineDeal.Status, err
+		}
+	}
+
+	err = pipeline.updateStatus(offlineDeal, constants.OFFLINE_DEAL_STATUS_DOWNLOADED, "")
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return offlineDeal.Status, err
+	}
+
+	err = pipeline.updateStatus(offlineDeal, constants.OFFLINE_DEAL_STATUS_IMPORTING, "")
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return offlineDeal.Status, err
+	}
+
+	err = pipeline.Importer.LotusImportData(offlineDeal.DealCid, offlineDeal.FilePath)
+	if err != nil {
+		err = pipeline.reportFailure(offlineDeal, constants.OFFLINE_DEAL_STATUS_IMPORT_FAILED, err)
+		return offlineDeal.Status, err
+	}
+
+	err = pipeline.updateStatus(offlineDeal, constants.OFFLINE_DEAL_STATUS_IMPORTED, "")
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return offlineDeal.Status, err
+	}
+
+	return offlineDeal.Status, nil
+}
+
+//reports the failed status with err as note, the returned error wraps err and tells when the report failed as well
+func (pipeline *OfflineDealPipeline) reportFailure(offlineDeal *model.OfflineDeal, status string, err error) error {
+	logs.GetLogger().Error("deal cid:", offlineDeal.DealCid, ", ", err)
+	updateErr := pipeline.updateStatus(offlineDeal, status, err.Error())
+	if updateErr != nil {
+		err = fmt.Errorf("%w, failed to report status:%s to swan, %s", err, status, updateErr.Error())
+		logs.GetLogger().Error(err)
+	}
+
+	return err
+}
+
+//md5 of the car file given by the client when the task was created, empty when swan does not have it
+func (pipeline *OfflineDealPipeline) GetCarFileMd5(offlineDeal *model.OfflineDeal) (string, error) {
+	if offlineDeal.TaskUuid == nil || *offlineDeal.TaskUuid == "" || offlineDeal.CarFileUrl == "" {
+		return "", nil
+	}
+
+	carFile, err := pipeline.Source.GetCarFileByUuidUrl(*offlineDeal.TaskUuid, offlineDeal.CarFileUrl)
+	if err != nil {
+		logs.GetLogger().Error("deal cid:", offlineDeal.DealCid, ", ", err)
+		return "", err
+	}
+
+	if carFile.CarFile.FileMd5 == nil {
+		return "", nil
+	}
+
+	return *carFile.CarFile.FileMd5, nil
+}
+
+//[DownloadDir]/[file name of the car file url], or [DownloadDir]/[payload cid].car when the url has no file name
+func (pipeline *OfflineDealPipeline) GetCarFilePath(offlineDeal *model.OfflineDeal) string {
+	fileName := offlineDeal.PayloadCid + car.CAR_FILE_EXTENSION
+	carFileUrl, err := url.Parse(offlineDeal.CarFileUrl)
+	if err == nil {
+		urlFileName := path.Base(carFileUrl.Path)
+		if urlFileName != "." && urlFileName != "/" {
+			fileName = urlFileName
+		}
+	}
+
+	return filepath.Join(pipeline.DownloadDir, fileName)
+}
+
+//downloads the car file with aria2 and waits until it is stopped, returns the path of the downloaded file,
+//the download is removed from aria2 when ctx is done
+func (pipeline *OfflineDealPipeline) Download(ctx context.Context, offlineDeal *model.OfflineDeal) (string, error) {
+	if strings.TrimSpace(offlineDeal.CarFileUrl) == "" {
+		err := fmt.Errorf("deal cid:%s, no car file url", offlineDeal.DealCid)
+		logs.GetLogger().Error(err)
+		return "", err
+	}
+
+	carFilePath := pipeline.GetCarFilePath(offlineDeal)
+	aria2DownloadOption := &client.Aria2DownloadOption{
+		Dir:    filepath.Dir(carFilePath),
+		Out:    filepath.Base(carFilePath),
+		Header: pipeline.DownloadHeader,
+	}
+
+	gid, err := pipeline.Downloader.AddUri(ctx, []string{offlineDeal.CarFileUrl}, aria2DownloadOption)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return "", err
+	}
+
+	//an active download left in aria2 would be renamed to [file name].1 when it is added again
+	removeDownload := func() {
+		_, err := pipeline.Downloader.Remove(context.Background(), gid, true)
+		if err != nil {
+			logs.GetLogger().Error("deal cid:", offlineDeal.DealCid, ", failed to remove download:", gid, ", ", err)
+		}
+	}
+
+	pollInterval := pipeline.PollInterval
+	if pollInterval <= 0 {
+		pollInterval = OFFLINE_DEAL_PIPELINE_POLL_INTERVAL_DEFAULT
+	}
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		aria2StatusResult, err := pipeline.Downloader.TellStatus(ctx, gid)
+		if err != nil {
+			logs.GetLogger().Error(err)
+			removeDownload()
+			return "", err
+		}
+
+		progress, err := aria2StatusResult.GetProgress()
+		if err != nil {
+			logs.GetLogger().Error(err)
+			removeDownload()
+			return "", err
+		}
+
+		switch progress.State {
+		case client.Aria2DownloadComplete:
+			if len(progress.Files) > 0 && progress.Files[0].Path != "" {
+				carFilePath = progress.Files[0].Path
+			}
+			logs.GetLogger().Info("deal cid:", offlineDeal.DealCid, ", downloaded to ", carFilePath)
+			return carFilePath, nil
+		case client.Aria2DownloadError, client.Aria2DownloadRemoved:
+			err := fmt.Errorf("deal cid:%s, download %s, error code:%d, %s", offlineDeal.DealCid, progress.State, progress.ErrorCode, progress.ErrorMessage)
+			logs.GetLogger().Error(err)
+			return "", err
+		}
+
+		select {
+		case <-ctx.Done():
+			removeDownload()
+			return "", ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+//checks the car file at offlineDeal.FilePath against the size of the deal and carFileMd5, when they are set,
+//returns ErrNothingToVerify when nothing is checked
+func (pipeline *OfflineDealPipeline) Verify(offlineDeal *model.OfflineDeal, carFileMd5 string) error {
+	if offlineDeal.CarFileSize <= 0 && carFileMd5 == "" && !pipeline.VerifyCarFile {
+		err := fmt.Errorf("deal cid:%s, %w", offlineDeal.DealCid, ErrNothingToVerify)
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	if offlineDeal.CarFileSize > 0 {
+		fileSize := utils.GetFileSize(offlineDeal.FilePath)
+		if fileSize != offlineDeal.CarFileSize {
+			err := fmt.Errorf("deal cid:%s, car file size:%d, expected:%d, %w", offlineDeal.DealCid, fileSize, offlineDeal.CarFileSize, car.ErrCarSizeMismatch)
+			logs.GetLogger().Error(err)
+			return err
+		}
+	}
+
+	if carFileMd5 != "" {
+		fileMd5, err := utils.GetFileMd5(offlineDeal.FilePath)
+		if err != nil {
+			logs.GetLogger().Error(err)
+			return err
+		}
+
+		if !strings.EqualFold(fileMd5, carFileMd5) {
+			err := fmt.Errorf("deal cid:%s, car file md5:%s, expected:%s", offlineDeal.DealCid, fileMd5, carFileMd5)
+			logs.GetLogger().Error(err)
+			return err
+		}
+	}
+
+	if pipeline.VerifyCarFile {
+		_, err := car.VerifyOfflineDealCarFile(offlineDeal)
+		if err != nil {
+			logs.GetLogger().Error(err)
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (pipeline *OfflineDealPipeline) updateStatus(offlineDeal *model.OfflineDeal, status, note string) error {
+	params := swan.UpdateOfflineDealParams{
+		DealId: offlineDeal.Id,
+		Status: status,
+	}
+
+	if offlineDeal.FilePath != "" {
+		params.FilePath = &offlineDeal.FilePath
+	}
+
+	if note != "" {
+		params.Note = &note
+	}
+
+	err := pipeline.Source.UpdateOfflineDeal(params)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	offlineDeal.Status = status
+	offlineDeal.Note = note
+	logs.GetLogger().Info("deal cid:", offlineDeal.DealCid, ", status:", status, " ", note)
+	if pipeline.OnStatus != nil {
+		pipeline.OnStatus(offlineDeal, status, note)
+	}
+
+	return nil
+}
@@ -0,0 +1,241 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/filswan/go-swan-lib/client"
+	"github.com/filswan/go-swan-lib/client/swan"
+	"github.com/filswan/go-swan-lib/constants"
+	"github.com/filswan/go-swan-lib/model"
+)
+
+//keeps the offline deals of swan in memory and pages the Created ones like swan does
+type fakeOfflineDealSource struct {
+	mutex        sync.Mutex
+	offlineDeals []*model.OfflineDeal
+	ignorePaging bool // every page is the first one
+	fetches      int
+}
+
+func (source *fakeOfflineDealSource) GetOfflineDealsByStatus(params swan.GetOfflineDealsByStatusParams) ([]*model.OfflineDeal, error) {
+	source.mutex.Lock()
+	defer source.mutex.Unlock()
+
+	source.fetches++
+	if source.fetches > 1000 {
+		return nil, fmt.Errorf("too many fetches")
+	}
+
+	offlineDeals := []*model.OfflineDeal{}
+	for _, offlineDeal := range source.offlineDeals {
+		if offlineDeal.Status == params.DealStatus {
+			offlineDealCopy := *offlineDeal
+			offlineDeals = append(offlineDeals, &offlineDealCopy)
+		}
+	}
+
+	start := 0
+	if !source.ignorePaging {
+		start = (*params.PageNum - 1) * *params.PageSize
+	}
+	if start > len(offlineDeals) {
+		start = len(offlineDeals)
+	}
+
+	end := start + *params.PageSize
+	if end > len(offlineDeals) {
+		end = len(offlineDeals)
+	}
+
+	return offlineDeals[start:end], nil
+}
+
+func (source *fakeOfflineDealSource) UpdateOfflineDeal(params swan.UpdateOfflineDealParams) error {
+	source.mutex.Lock()
+	defer source.mutex.Unlock()
+
+	for _, offlineDeal := range source.offlineDeals {
+		if offlineDeal.Id == params.DealId {
+			offlineDeal.Status = params.Status
+			return nil
+		}
+	}
+
+	return fmt.Errorf("deal:%d not found", params.DealId)
+}
+
+func (source *fakeOfflineDealSource) GetCarFileByUuidUrl(taskUuid, carFileUrl string) (*swan.GetCarFileByUuidUrlResultData, error) {
+	return &swan.GetCarFileByUuidUrlResultData{}, nil
+}
+
+func (source *fakeOfflineDealSource) getStatus(dealId int) string {
+	source.mutex.Lock()
+	defer source.mutex.Unlock()
+
+	for _, offlineDeal := range source.offlineDeals {
+		if offlineDeal.Id == dealId {
+			return offlineDeal.Status
+		}
+	}
+
+	return ""
+}
+
+//writes the content of the car file url at once
+type fakeDownloader struct {
+	mutex sync.Mutex
+	paths map[string]string
+}
+
+func getCarFileContent(carFileUrl string) []byte {
+	return []byte("car file of " + carFileUrl)
+}
+
+func (downloader *fakeDownloader) AddUri(ctx context.Context, uris []string, aria2DownloadOption *client.Aria2DownloadOption) (string, error) {
+	path := filepath.Join(aria2DownloadOption.Dir, aria2DownloadOption.Out)
+	err := ioutil.WriteFile(path, getCarFileContent(uris[0]), 0644)
+	if err != nil {
+		return "", err
+	}
+
+	downloader.mutex.Lock()
+	defer downloader.mutex.Unlock()
+
+	gid := fmt.Sprintf("gid%d", len(downloader.paths))
+	downloader.paths[gid] = path
+	return gid, nil
+}
+
+func (downloader *fakeDownloader) TellStatus(ctx context.Context, gid string, keys ...string) (*client.Aria2StatusResult, error) {
+	downloader.mutex.Lock()
+	defer downloader.mutex.Unlock()
+
+	aria2StatusResult := &client.Aria2StatusResult{
+		Gid:    gid,
+		Status: "complete",
+		Files:  []client.Aria2StatusResultFile{{Path: downloader.paths[gid]}},
+	}
+
+	return aria2StatusResult, nil
+}
+
+func (downloader *fakeDownloader) Remove(ctx context.Context, gid string, force bool) (string, error) {
+	return gid, nil
+}
+
+type fakeImporter struct {
+	mutex    sync.Mutex
+	dealCids []string
+}
+
+func (importer *fakeImporter) LotusImportData(dealCid string, filepath string) error {
+	importer.mutex.Lock()
+	defer importer.mutex.Unlock()
+
+	importer.dealCids = append(importer.dealCids, dealCid)
+	return nil
+}
+
+//deals with a car file size can be verified, deals without it are left Created with ErrNothingToVerify
+func getOfflineDeals(verifiable ...bool) []*model.OfflineDeal {
+	offlineDeals := []*model.OfflineDeal{}
+	for i, canVerify := range verifiable {
+		carFileUrl := fmt.Sprintf("https://example.com/deal%d.car", i+1)
+		offlineDeal := &model.OfflineDeal{
+			Id:         i + 1,
+			DealCid:    fmt.Sprintf("deal%d", i+1),
+			Status:     constants.OFFLINE_DEAL_STATUS_CREATED,
+			CarFileUrl: carFileUrl,
+		}
+		if canVerify {
+			offlineDeal.CarFileSize = int64(len(getCarFileContent(carFileUrl)))
+		}
+		offlineDeals = append(offlineDeals, offlineDeal)
+	}
+
+	return offlineDeals
+}
+
+func TestOfflineDealPipelineRun(t *testing.T) {
+	const Y, N = true, false
+
+	tests := []struct {
+		name         string
+		verifiable   []bool
+		pageSize     int
+		ignorePaging bool
+		imported     int
+	}{
+		{"no deal", nil, 3, false, 0},
+		{"one short page", []bool{Y, Y}, 3, false, 2},
+		{"several pages", []bool{Y, Y, Y, Y, Y, Y, Y}, 3, false, 7},
+		{"page full of deals with nothing to verify", []bool{N, N, N, Y, Y, Y, Y}, 3, false, 4},
+		{"pages full of deals with nothing to verify", []bool{N, N, N, N, N, N, Y, Y}, 3, false, 2},
+		{"deals with nothing to verify spread over pages", []bool{N, Y, N, Y, N, N, Y, N, N, Y}, 3, false, 4},
+		{"deals with nothing to verify on a full last page", []bool{Y, Y, N, N, N}, 3, false, 2},
+		{"swan ignores paging", []bool{N, N, N, Y, Y}, 3, true, 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			source := &fakeOfflineDealSource{
+				offlineDeals: getOfflineDeals(test.verifiable...),
+				ignorePaging: test.ignorePaging,
+			}
+			importer := &fakeImporter{}
+			pipeline := GetOfflineDealPipeline(source, &fakeDownloader{paths: map[string]string{}}, importer, "f01000", t.TempDir())
+			pipeline.PageSize = test.pageSize
+			pipeline.PollInterval = time.Millisecond
+
+			results, err := pipeline.Run(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(importer.dealCids) != test.imported {
+				t.Errorf("imported deals = %v, want %d of them", importer.dealCids, test.imported)
+			}
+
+			resultDealIds := map[int]bool{}
+			for _, result := range results {
+				if resultDealIds[result.OfflineDeal.Id] {
+					t.Errorf("deal %d is processed more than once", result.OfflineDeal.Id)
+				}
+				resultDealIds[result.OfflineDeal.Id] = true
+
+				canVerify := test.verifiable[result.OfflineDeal.Id-1]
+				status := source.getStatus(result.OfflineDeal.Id)
+				switch {
+				case canVerify && (result.Error != nil || status != constants.OFFLINE_DEAL_STATUS_IMPORTED):
+					t.Errorf("deal %d: status = %s, error = %v, want %s", result.OfflineDeal.Id, status, result.Error, constants.OFFLINE_DEAL_STATUS_IMPORTED)
+				case !canVerify && (!errors.Is(result.Error, ErrNothingToVerify) || status != constants.OFFLINE_DEAL_STATUS_CREATED):
+					t.Errorf("deal %d: status = %s, error = %v, want %s with ErrNothingToVerify", result.OfflineDeal.Id, status, result.Error, constants.OFFLINE_DEAL_STATUS_CREATED)
+				}
+			}
+
+			if !test.ignorePaging && len(results) != len(test.verifiable) {
+				t.Errorf("results = %d, want %d", len(results), len(test.verifiable))
+			}
+		})
+	}
+}
+
+func TestOfflineDealPipelineRunCanceled(t *testing.T) {
+	source := &fakeOfflineDealSource{offlineDeals: getOfflineDeals(true, true)}
+	pipeline := GetOfflineDealPipeline(source, &fakeDownloader{paths: map[string]string{}}, &fakeImporter{}, "f01000", t.TempDir())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := pipeline.Run(ctx)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("error = %v, want context.Canceled", err)
+	}
+}
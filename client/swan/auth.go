@@ -1,10 +1,10 @@
 package swan
 
 import (
+	"context"
 	"fmt"
 	"strings"
 
-	"github.com/filswan/go-swan-lib/client/web"
 	"github.com/filswan/go-swan-lib/logs"
 	"github.com/filswan/go-swan-lib/utils"
 )
@@ -45,7 +45,7 @@ func (swanClient *SwanClient) GetJwtTokenByApiKey() error {
 
 	apiUrl := utils.UrlJoin(swanClient.ApiUrl, "user/login_by_apikey")
 
-	response, err := web.HttpPostNoToken(apiUrl, data)
+	response, err := swanClient.getWebClient().Post(context.Background(), apiUrl, "", data)
 	if err != nil {
 		logs.GetLogger().Error(err)
 		return err
@@ -54,14 +54,14 @@ func (swanClient *SwanClient) GetJwtTokenByApiKey() error {
 	if strings.Contains(string(response), "fail") {
 		message := utils.GetFieldStrFromJson(response, "message")
 		status := utils.GetFieldStrFromJson(response, "status")
-		err := fmt.Errorf("status:%s, message:%s", status, message)
+		err := newAPIError(apiUrl, status, message)
 		logs.GetLogger().Error(err)
 
-		if message == "apikey not found" {
+		if message == SWAN_API_MESSAGE_APIKEY_NOT_FOUND {
 			logs.GetLogger().Error("please check your api key")
 		}
 
-		if message == "access token wrong" {
+		if message == SWAN_API_MESSAGE_ACCESS_TOKEN_WRONG {
 			logs.GetLogger().Error("Please check your access token")
 		}
 
@@ -101,17 +101,9 @@ func (swanClient *SwanClient) GetJwtTokenUp3Times() error {
 		return err
 	}
 
-	var err error
-	for i := 0; i < 3; i++ {
-		err = swanClient.GetJwtTokenByApiKey()
-		if err == nil {
-			break
-		}
-		logs.GetLogger().Error(err)
-	}
-
+	err := swanClient.RetryPolicy.Do(context.Background(), swanClient.GetJwtTokenByApiKey)
 	if err != nil {
-		err = fmt.Errorf("failed to connect to swan platform after trying 3 times")
+		err = fmt.Errorf("failed to connect to swan platform, %w", err)
 		logs.GetLogger().Error(err)
 		return err
 	}
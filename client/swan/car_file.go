@@ -1,19 +1,20 @@
 package swan
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"strings"
 
-	"github.com/filswan/go-swan-lib/client/web"
 	"github.com/filswan/go-swan-lib/constants"
 	"github.com/filswan/go-swan-lib/logs"
 	"github.com/filswan/go-swan-lib/model"
 )
 
 type GetCarFileByUuidUrlResult struct {
-	Data   GetCarFileByUuidUrlResultData `json:"data"`
-	Status string                        `json:"status"`
+	Data    GetCarFileByUuidUrlResultData `json:"data"`
+	Status  string                        `json:"status"`
+	Message string                        `json:"message"`
 }
 type GetCarFileByUuidUrlResultData struct {
 	CarFile          model.CarFile        `json:"car_file"`
@@ -39,7 +40,7 @@ func (swanClient *SwanClient) GetCarFileByUuidUrl(taskUuid, carFileUrl string) (
 
 	apiUrl := fmt.Sprintf("%s/car_files/car_file?task_uuid=%s&car_file_url=%s", swanClient.ApiUrl, taskUuid, carFileUrl)
 
-	response, err := web.HttpGet(apiUrl, swanClient.SwanToken, "")
+	response, err := swanClient.getWebClient().Get(context.Background(), apiUrl, swanClient.SwanToken, "")
 
 	if err != nil {
 		logs.GetLogger().Error(err)
@@ -54,7 +55,7 @@ func (swanClient *SwanClient) GetCarFileByUuidUrl(taskUuid, carFileUrl string) (
 	}
 
 	if !strings.EqualFold(getCarFileByUuidUrlResult.Status, constants.SWAN_API_STATUS_SUCCESS) {
-		err := fmt.Errorf("error:%s", getCarFileByUuidUrlResult.Status)
+		err := newAPIError(apiUrl, getCarFileByUuidUrlResult.Status, getCarFileByUuidUrlResult.Message)
 		logs.GetLogger().Error(err)
 		return nil, err
 	}
@@ -63,8 +64,9 @@ func (swanClient *SwanClient) GetCarFileByUuidUrl(taskUuid, carFileUrl string) (
 }
 
 type GetAutoBidCarFilesByStatusResult struct {
-	Data   GetAutoBidCarFilesByStatusResultData `json:"data"`
-	Status string                               `json:"status"`
+	Data    GetAutoBidCarFilesByStatusResultData `json:"data"`
+	Status  string                               `json:"status"`
+	Message string                               `json:"message"`
 }
 type GetAutoBidCarFilesByStatusResultData struct {
 	CarFile          model.CarFile        `json:"car_file"`
@@ -85,7 +87,7 @@ func (swanClient *SwanClient) GetAutoBidCarFilesByStatus(carFileStatus string) (
 
 	apiUrl := fmt.Sprintf("%s/car_files/auto_bid/get_by_status?car_file_status=%s", swanClient.ApiUrl, carFileStatus)
 
-	response, err := web.HttpGet(apiUrl, swanClient.SwanToken, "")
+	response, err := swanClient.getWebClient().Get(context.Background(), apiUrl, swanClient.SwanToken, "")
 	if err != nil {
 		logs.GetLogger().Error(err)
 		return nil, err
@@ -99,7 +101,7 @@ func (swanClient *SwanClient) GetAutoBidCarFilesByStatus(carFileStatus string) (
 	}
 
 	if !strings.EqualFold(getAutoBidCarFilesByStatusResult.Status, constants.SWAN_API_STATUS_SUCCESS) {
-		err := fmt.Errorf("error:%s", getAutoBidCarFilesByStatusResult.Status)
+		err := newAPIError(apiUrl, getAutoBidCarFilesByStatusResult.Status, getAutoBidCarFilesByStatusResult.Message)
 		logs.GetLogger().Error(err)
 		return nil, err
 	}
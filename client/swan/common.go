@@ -3,6 +3,7 @@ package swan
 import (
 	"fmt"
 
+	"github.com/filswan/go-swan-lib/client/web"
 	"github.com/filswan/go-swan-lib/constants"
 	"github.com/filswan/go-swan-lib/logs"
 )
@@ -12,6 +13,7 @@ type SwanClient struct {
 	SwanToken   string
 	ApiKey      string
 	AccessToken string
+	RetryPolicy *web.RetryPolicy // applied to idempotent requests and login, nil means no retry
 }
 type SwanServerResponse struct {
 	Status  string `json:"status"`
@@ -30,6 +32,7 @@ func GetClient(apiUrl, apiKey, accessToken, swanToken string) (*SwanClient, erro
 		ApiKey:      apiKey,
 		AccessToken: accessToken,
 		SwanToken:   swanToken,
+		RetryPolicy: web.DefaultRetryPolicy(),
 	}
 
 	if swanToken == constants.EMPTY_STRING {
@@ -39,3 +42,7 @@ func GetClient(apiUrl, apiKey, accessToken, swanToken string) (*SwanClient, erro
 
 	return swanClient, nil
 }
+
+func (swanClient *SwanClient) getWebClient() *web.Client {
+	return web.GetDefaultClient().WithRetryPolicy(swanClient.RetryPolicy)
+}
@@ -0,0 +1,48 @@
+package swan
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/filswan/go-swan-lib/client/web"
+)
+
+const (
+	SWAN_API_MESSAGE_APIKEY_NOT_FOUND   = "apikey not found"
+	SWAN_API_MESSAGE_ACCESS_TOKEN_WRONG = "access token wrong"
+)
+
+//returned when swan api responds with a status other than success
+type APIError struct {
+	Status  string
+	Message string
+	Url     string
+}
+
+func newAPIError(apiUrl, status, message string) *APIError {
+	return &APIError{
+		Status:  status,
+		Message: message,
+		Url:     apiUrl,
+	}
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("status:%s, message:%s, url:%s", e.Status, e.Message, e.Url)
+}
+
+func (e *APIError) Is(target error) bool {
+	message := strings.ToLower(e.Message)
+	switch target {
+	case web.ErrUnauthorized:
+		return message == SWAN_API_MESSAGE_APIKEY_NOT_FOUND ||
+			message == SWAN_API_MESSAGE_ACCESS_TOKEN_WRONG ||
+			strings.Contains(message, "unauthorized")
+	case web.ErrInsufficientPermission:
+		return strings.Contains(message, "permission")
+	case web.ErrNotFound:
+		return message != SWAN_API_MESSAGE_APIKEY_NOT_FOUND && strings.Contains(message, "not found")
+	default:
+		return false
+	}
+}
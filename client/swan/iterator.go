@@ -0,0 +1,115 @@
+package swan
+
+import (
+	"context"
+	"io"
+
+	"github.com/filswan/go-swan-lib/logs"
+	"github.com/filswan/go-swan-lib/model"
+)
+
+const OFFLINE_DEAL_PAGE_NUM_FIRST = 1
+
+//pages through the offline deals of GetOfflineDealsByStatusParams, a page is requested only when the previous one is consumed
+type OfflineDealIterator struct {
+	swanClient   *SwanClient
+	params       GetOfflineDealsByStatusParams
+	pageNum      int
+	pageSize     int
+	offlineDeals []*model.OfflineDeal
+	fetched      int
+	totalItems   int
+	done         bool
+	dealIds      map[int]bool // deals already returned, a page without a new deal is the last one
+}
+
+//params.PageNum is the first page, OFFLINE_DEAL_PAGE_NUM_FIRST when nil,
+//params.PageSize is the size of each page, GET_OFFLINEDEAL_LIMIT_DEFAULT when nil
+func (swanClient *SwanClient) GetOfflineDealIterator(params GetOfflineDealsByStatusParams) *OfflineDealIterator {
+	offlineDealIterator := &OfflineDealIterator{
+		swanClient: swanClient,
+		params:     params,
+		pageNum:    OFFLINE_DEAL_PAGE_NUM_FIRST,
+		pageSize:   GET_OFFLINEDEAL_LIMIT_DEFAULT,
+		totalItems: -1,
+		dealIds:    map[int]bool{},
+	}
+
+	if params.PageNum != nil {
+		offlineDealIterator.pageNum = *params.PageNum
+	}
+
+	if params.PageSize != nil && *params.PageSize > 0 {
+		offlineDealIterator.pageSize = *params.PageSize
+	}
+
+	return offlineDealIterator
+}
+
+//returns io.EOF after the last deal, ctx applies to the request of the next page
+func (offlineDealIterator *OfflineDealIterator) Next(ctx context.Context) (*model.OfflineDeal, error) {
+	if len(offlineDealIterator.offlineDeals) == 0 {
+		err := offlineDealIterator.fetch(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	offlineDeal := offlineDealIterator.offlineDeals[0]
+	offlineDealIterator.offlineDeals = offlineDealIterator.offlineDeals[1:]
+	return offlineDeal, nil
+}
+
+func (offlineDealIterator *OfflineDealIterator) fetch(ctx context.Context) error {
+	if offlineDealIterator.done {
+		return io.EOF
+	}
+
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	params := offlineDealIterator.params
+	pageNum := offlineDealIterator.pageNum
+	pageSize := offlineDealIterator.pageSize
+	params.PageNum = &pageNum
+	params.PageSize = &pageSize
+
+	getOfflineDealsByStatusResponse, err := offlineDealIterator.swanClient.getOfflineDealsByStatus(ctx, params)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	pageDeals := getOfflineDealsByStatusResponse.Data.OfflineDeals
+	offlineDeals := []*model.OfflineDeal{}
+	for _, offlineDeal := range pageDeals {
+		if !offlineDealIterator.dealIds[offlineDeal.Id] {
+			offlineDealIterator.dealIds[offlineDeal.Id] = true
+			offlineDeals = append(offlineDeals, offlineDeal)
+		}
+	}
+
+	offlineDealIterator.pageNum++
+	offlineDealIterator.fetched += len(offlineDeals)
+	offlineDealIterator.totalItems = getOfflineDealsByStatusResponse.Data.TotalItems
+	offlineDealIterator.offlineDeals = offlineDeals
+	offlineDealIterator.done = isLastPage(len(pageDeals), pageSize, offlineDealIterator.fetched, offlineDealIterator.totalItems)
+
+	if len(offlineDeals) == 0 {
+		offlineDealIterator.done = true
+		return io.EOF
+	}
+
+	return nil
+}
+
+//the total number of deals reported by swan, -1 before the first page is requested, 0 when swan does not report it
+func (offlineDealIterator *OfflineDealIterator) TotalItems() int {
+	return offlineDealIterator.totalItems
+}
+
+//a short page is the last one, so is the page reaching the total when swan reports it
+func isLastPage(itemCount, pageSize, fetched, totalItems int) bool {
+	return itemCount < pageSize || (totalItems > 0 && fetched >= totalItems)
+}
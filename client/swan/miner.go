@@ -1,11 +1,11 @@
 package swan
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"strings"
 
-	"github.com/filswan/go-swan-lib/client/web"
 	"github.com/filswan/go-swan-lib/constants"
 	"github.com/filswan/go-swan-lib/logs"
 	"github.com/filswan/go-swan-lib/model"
@@ -23,7 +23,7 @@ type MinerResponse struct {
 func (swanClient *SwanClient) GetMiner(minerFid string) (*MinerResponse, error) {
 	apiUrl := utils.UrlJoin(swanClient.ApiUrl, "miners", minerFid)
 
-	response, err := web.HttpGetNoToken(apiUrl, "")
+	response, err := swanClient.getWebClient().Get(context.Background(), apiUrl, "", "")
 	if err != nil {
 		logs.GetLogger().Error(err)
 		return nil, err
@@ -37,7 +37,7 @@ func (swanClient *SwanClient) GetMiner(minerFid string) (*MinerResponse, error)
 	}
 
 	if !strings.EqualFold(minerResponse.Status, constants.SWAN_API_STATUS_SUCCESS) {
-		err := fmt.Errorf("status:%s, message:%s", minerResponse.Status, minerResponse.Message)
+		err := newAPIError(apiUrl, minerResponse.Status, minerResponse.Message)
 		logs.GetLogger().Error(err)
 		return nil, err
 
@@ -93,7 +93,7 @@ func (swanClient *SwanClient) UpdateMinerBidConf(minerFid string, confMiner mode
 		AutoBidDealPerDay:   confMiner.AutoBidDealPerDay,
 	}
 
-	response, err := web.HttpPost(apiUrl, swanClient.SwanToken, params)
+	response, err := swanClient.getWebClient().Post(context.Background(), apiUrl, swanClient.SwanToken, params)
 	if err != nil {
 		logs.GetLogger().Error(err)
 		return err
@@ -106,8 +106,8 @@ func (swanClient *SwanClient) UpdateMinerBidConf(minerFid string, confMiner mode
 		return err
 	}
 
-	if !strings.EqualFold(minerResponse.Status, constants.SWAN_API_STATUS_SUCCESS) {
-		err := fmt.Errorf("%s,%s", minerResponse.Status, minerResponse.Message)
+	if !strings.EqualFold(swanServerResponse.Status, constants.SWAN_API_STATUS_SUCCESS) {
+		err := newAPIError(apiUrl, swanServerResponse.Status, swanServerResponse.Message)
 		logs.GetLogger().Error(err)
 		return err
 	}
@@ -132,7 +132,7 @@ func (swanClient *SwanClient) SendHeartbeatRequest(minerFid string) error {
 		MinerFid: minerFid,
 	}
 
-	response, err := web.HttpPost(apiUrl, swanClient.SwanToken, params)
+	response, err := swanClient.getWebClient().Post(context.Background(), apiUrl, swanClient.SwanToken, params)
 	if err != nil {
 		logs.GetLogger().Error(err)
 		return err
@@ -146,7 +146,7 @@ func (swanClient *SwanClient) SendHeartbeatRequest(minerFid string) error {
 	}
 
 	if !strings.EqualFold(swanServerResponse.Status, constants.SWAN_API_STATUS_SUCCESS) {
-		err := fmt.Errorf("%s,%s", swanServerResponse.Status, swanServerResponse.Message)
+		err := newAPIError(apiUrl, swanServerResponse.Status, swanServerResponse.Message)
 		logs.GetLogger().Error(err)
 		return err
 	}
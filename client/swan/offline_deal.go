@@ -1,11 +1,11 @@
 package swan
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"strings"
 
-	"github.com/filswan/go-swan-lib/client/web"
 	"github.com/filswan/go-swan-lib/constants"
 	"github.com/filswan/go-swan-lib/logs"
 	"github.com/filswan/go-swan-lib/model"
@@ -27,11 +27,23 @@ type GetOfflineDealsByStatusParams struct {
 type GetOfflineDealsByStatusResponse struct {
 	Data struct {
 		OfflineDeals []*model.OfflineDeal `json:"offline_deals"`
+		TotalItems   int                  `json:"total_items"`
 	} `json:"data"`
-	Status string `json:"status"`
+	Status  string `json:"status"`
+	Message string `json:"message"`
 }
 
 func (swanClient *SwanClient) GetOfflineDealsByStatus(params GetOfflineDealsByStatusParams) ([]*model.OfflineDeal, error) {
+	getOfflineDealsByStatusResponse, err := swanClient.getOfflineDealsByStatus(context.Background(), params)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	return getOfflineDealsByStatusResponse.Data.OfflineDeals, nil
+}
+
+func (swanClient *SwanClient) getOfflineDealsByStatus(ctx context.Context, params GetOfflineDealsByStatusParams) (*GetOfflineDealsByStatusResponse, error) {
 	if utils.IsStrEmpty(&params.DealStatus) {
 		err := fmt.Errorf("deal status is required")
 		logs.GetLogger().Error(err)
@@ -45,26 +57,26 @@ func (swanClient *SwanClient) GetOfflineDealsByStatus(params GetOfflineDealsBySt
 	}
 
 	apiUrl := utils.UrlJoin(swanClient.ApiUrl, "offline_deals/get_by_status")
-	response, err := web.HttpGet(apiUrl, swanClient.SwanToken, params)
+	response, err := swanClient.getWebClient().Get(ctx, apiUrl, swanClient.SwanToken, params)
 	if err != nil {
 		logs.GetLogger().Error(err)
 		return nil, err
 	}
 
-	getOfflineDealsByStatusResponse := GetOfflineDealsByStatusResponse{}
-	err = json.Unmarshal([]byte(response), &getOfflineDealsByStatusResponse)
+	getOfflineDealsByStatusResponse := &GetOfflineDealsByStatusResponse{}
+	err = json.Unmarshal([]byte(response), getOfflineDealsByStatusResponse)
 	if err != nil {
 		logs.GetLogger().Error(err)
 		return nil, err
 	}
 
 	if !strings.EqualFold(getOfflineDealsByStatusResponse.Status, constants.SWAN_API_STATUS_SUCCESS) {
-		err := fmt.Errorf("get offline deal with status:%s failed", params.DealStatus)
+		err := fmt.Errorf("get offline deal with status:%s failed, %w", params.DealStatus, newAPIError(apiUrl, getOfflineDealsByStatusResponse.Status, getOfflineDealsByStatusResponse.Message))
 		logs.GetLogger().Error(err)
 		return nil, err
 	}
 
-	return getOfflineDealsByStatusResponse.Data.OfflineDeals, nil
+	return getOfflineDealsByStatusResponse, nil
 }
 
 type UpdateOfflineDealParams struct {
@@ -98,7 +110,7 @@ func (swanClient *SwanClient) UpdateOfflineDeal(params UpdateOfflineDealParams)
 
 	apiUrl := utils.UrlJoin(swanClient.ApiUrl, "offline_deals/update_offline_deal")
 
-	response, err := web.HttpPut(apiUrl, swanClient.SwanToken, params)
+	response, err := swanClient.getWebClient().Put(context.Background(), apiUrl, swanClient.SwanToken, params)
 	if err != nil {
 		logs.GetLogger().Error(err)
 		return err
@@ -112,7 +124,7 @@ func (swanClient *SwanClient) UpdateOfflineDeal(params UpdateOfflineDealParams)
 	}
 
 	if !strings.EqualFold(swanServerResponse.Status, constants.SWAN_API_STATUS_SUCCESS) {
-		err := fmt.Errorf("deal(id=%d),failed to update offline deal status to %s,%s", params.DealId, params.Status, swanServerResponse.Message)
+		err := fmt.Errorf("deal(id=%d),failed to update offline deal status to %s,%w", params.DealId, params.Status, newAPIError(apiUrl, swanServerResponse.Status, swanServerResponse.Message))
 		logs.GetLogger().Error(err)
 		return err
 	}
@@ -123,7 +135,7 @@ func (swanClient *SwanClient) UpdateOfflineDeal(params UpdateOfflineDealParams)
 //for public and non auto-bid task
 func (swanClient *SwanClient) CreateOfflineDeals(fileDescs []*model.FileDesc) (*SwanServerResponse, error) {
 	apiUrl := utils.UrlJoin(swanClient.ApiUrl, "offline_deals/create_offline_deals")
-	response, err := web.HttpPost(apiUrl, swanClient.SwanToken, fileDescs)
+	response, err := swanClient.getWebClient().Post(context.Background(), apiUrl, swanClient.SwanToken, fileDescs)
 	if err != nil {
 		logs.GetLogger().Error(err)
 		return nil, err
@@ -137,7 +149,7 @@ func (swanClient *SwanClient) CreateOfflineDeals(fileDescs []*model.FileDesc) (*
 	}
 
 	if !strings.EqualFold(swanServerResponse.Status, constants.SWAN_API_STATUS_SUCCESS) {
-		err := fmt.Errorf("error:%s,%s", swanServerResponse.Status, swanServerResponse.Message)
+		err := newAPIError(apiUrl, swanServerResponse.Status, swanServerResponse.Message)
 		logs.GetLogger().Error(err)
 		return nil, err
 	}
@@ -1,18 +1,21 @@
 package swan
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"net/url"
 	"strconv"
 	"strings"
 
-	"github.com/filswan/go-swan-lib/client/web"
 	"github.com/filswan/go-swan-lib/constants"
 	"github.com/filswan/go-swan-lib/logs"
 	"github.com/filswan/go-swan-lib/model"
 	"github.com/filswan/go-swan-lib/utils"
 )
 
+const TASK_LIMIT_ALL = -1
+
 func (swanClient *SwanClient) CreateTask(task model.Task, fileDescs []*model.FileDesc) (*SwanServerResponse, error) {
 	apiUrl := utils.UrlJoin(swanClient.ApiUrl, "tasks/create_task")
 	params := map[string]interface{}{
@@ -20,7 +23,7 @@ func (swanClient *SwanClient) CreateTask(task model.Task, fileDescs []*model.Fil
 		"file_descs": fileDescs,
 	}
 
-	response, err := web.HttpPost(apiUrl, swanClient.SwanToken, params)
+	response, err := swanClient.getWebClient().Post(context.Background(), apiUrl, swanClient.SwanToken, params)
 	if err != nil {
 		logs.GetLogger().Error(err)
 		return nil, err
@@ -34,7 +37,7 @@ func (swanClient *SwanClient) CreateTask(task model.Task, fileDescs []*model.Fil
 	}
 
 	if !strings.EqualFold(swanServerResponse.Status, constants.SWAN_API_STATUS_SUCCESS) {
-		err := fmt.Errorf("error:%s,%s", swanServerResponse.Status, swanServerResponse.Message)
+		err := newAPIError(apiUrl, swanServerResponse.Status, swanServerResponse.Message)
 		logs.GetLogger().Error(err)
 		return nil, err
 	}
@@ -43,8 +46,9 @@ func (swanClient *SwanClient) CreateTask(task model.Task, fileDescs []*model.Fil
 }
 
 type GetTaskResult struct {
-	Data   GetTaskResultData `json:"data"`
-	Status string            `json:"status"`
+	Data    GetTaskResultData `json:"data"`
+	Status  string            `json:"status"`
+	Message string            `json:"message"`
 }
 
 type GetTaskResultData struct {
@@ -53,25 +57,23 @@ type GetTaskResultData struct {
 	TotalTaskCount int          `json:"total_task_count"`
 }
 
+//the tasks endpoint takes only limit and status, it cannot page, a limit of TASK_LIMIT_ALL returns all the tasks
 func (swanClient *SwanClient) GetTasks(limit *int, status *string) (*GetTaskResult, error) {
 	apiUrl := utils.UrlJoin(swanClient.ApiUrl, "tasks")
-	filters := ""
+	filters := url.Values{}
 	if limit != nil {
-		filters = filters + "?limit=" + strconv.Itoa(*limit)
+		filters.Set("limit", strconv.Itoa(*limit))
 	}
 
 	if status != nil {
-		if filters == "" {
-			filters = filters + "?"
-		} else {
-			filters = filters + "&"
-		}
-		filters = filters + "status=" + *status
+		filters.Set("status", *status)
 	}
 
-	apiUrl = apiUrl + filters
+	if len(filters) > 0 {
+		apiUrl = apiUrl + "?" + filters.Encode()
+	}
 
-	response, err := web.HttpGet(apiUrl, swanClient.SwanToken, "")
+	response, err := swanClient.getWebClient().Get(context.Background(), apiUrl, swanClient.SwanToken, "")
 	if err != nil {
 		logs.GetLogger().Error(err)
 		return nil, err
@@ -85,7 +87,7 @@ func (swanClient *SwanClient) GetTasks(limit *int, status *string) (*GetTaskResu
 	}
 
 	if !strings.EqualFold(getTaskResult.Status, constants.SWAN_API_STATUS_SUCCESS) {
-		err := fmt.Errorf("error:%s", getTaskResult.Status)
+		err := newAPIError(apiUrl, getTaskResult.Status, getTaskResult.Message)
 		logs.GetLogger().Error(err)
 		return nil, err
 	}
@@ -94,18 +96,20 @@ func (swanClient *SwanClient) GetTasks(limit *int, status *string) (*GetTaskResu
 }
 
 func (swanClient *SwanClient) GetAllTasks(status string) ([]model.Task, error) {
-	limit := -1
+	limit := TASK_LIMIT_ALL
 	getTaskResult, err := swanClient.GetTasks(&limit, &status)
 	if err != nil {
 		logs.GetLogger().Error(err)
 		return nil, err
 	}
-	return getTaskResult.Data.Task, err
+
+	return getTaskResult.Data.Task, nil
 }
 
 type GetTaskByUuidResult struct {
-	Data   GetTaskByUuidResultData `json:"data"`
-	Status string                  `json:"status"`
+	Data    GetTaskByUuidResultData `json:"data"`
+	Status  string                  `json:"status"`
+	Message string                  `json:"message"`
 }
 type GetTaskByUuidResultData struct {
 	//AverageBid       string              `json:"average_bid"`
@@ -127,7 +131,7 @@ func (swanClient *SwanClient) GetTaskByUuid(taskUuid string) (*GetTaskByUuidResu
 	}
 	apiUrl := utils.UrlJoin(swanClient.ApiUrl, "tasks", taskUuid)
 
-	response, err := web.HttpGet(apiUrl, swanClient.SwanToken, "")
+	response, err := swanClient.getWebClient().Get(context.Background(), apiUrl, swanClient.SwanToken, "")
 	if err != nil {
 		logs.GetLogger().Error(err)
 		return nil, err
@@ -141,7 +145,7 @@ func (swanClient *SwanClient) GetTaskByUuid(taskUuid string) (*GetTaskByUuidResu
 	}
 
 	if !strings.EqualFold(getTaskByUuidResult.Status, constants.SWAN_API_STATUS_SUCCESS) {
-		err := fmt.Errorf("error:%s", getTaskByUuidResult.Status)
+		err := newAPIError(apiUrl, getTaskByUuidResult.Status, getTaskByUuidResult.Message)
 		logs.GetLogger().Error(err)
 		return nil, err
 	}
@@ -1,11 +1,10 @@
 package swan
 
 import (
-	"fmt"
+	"context"
 	"net/url"
 	"strings"
 
-	"github.com/filswan/go-swan-lib/client/web"
 	"github.com/filswan/go-swan-lib/constants"
 	"github.com/filswan/go-swan-lib/logs"
 	"github.com/filswan/go-swan-lib/utils"
@@ -15,7 +14,7 @@ func (swanClient *SwanClient) CheckDatacap(wallet string) (bool, error) {
 	apiUrl := swanClient.ApiUrl + "/tools/check_datacap?address=" + wallet
 	params := url.Values{}
 
-	response, err := web.HttpGetNoToken(apiUrl, strings.NewReader(params.Encode()))
+	response, err := swanClient.getWebClient().Get(context.Background(), apiUrl, "", strings.NewReader(params.Encode()))
 
 	if err != nil {
 		logs.GetLogger().Error(err)
@@ -26,7 +25,7 @@ func (swanClient *SwanClient) CheckDatacap(wallet string) (bool, error) {
 
 	if !strings.EqualFold(status, constants.SWAN_API_STATUS_SUCCESS) {
 		message := utils.GetFieldStrFromJson(response, "message")
-		err := fmt.Errorf("error:%s,%s", status, message)
+		err := newAPIError(apiUrl, status, message)
 		logs.GetLogger().Error(err)
 		return false, err
 	}
@@ -0,0 +1,366 @@
+package web
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/filswan/go-swan-lib/logs"
+)
+
+type ClientConfig struct {
+	Transport          http.RoundTripper // when set, it is used as is and the tls settings below are ignored
+	TLSConfig          *tls.Config       // base tls config, cloned before CaCertFile/CaCertPem/InsecureSkipVerify are applied
+	CaCertFile         string            // pem file with extra CA certificates to trust
+	CaCertPem          []byte            // pem content with extra CA certificates to trust
+	InsecureSkipVerify bool
+	TimeoutSecond      int          // 0 means no timeout other than the one from context
+	RetryPolicy        *RetryPolicy // nil means no retry
+}
+
+type Client struct {
+	httpClient  *http.Client
+	retryPolicy *RetryPolicy
+}
+
+var (
+	defaultClient      *Client
+	defaultClientMutex sync.RWMutex
+)
+
+func GetClient(config ClientConfig) (*Client, error) {
+	transport := config.Transport
+	if transport == nil {
+		tlsConfig, err := getTlsConfig(config)
+		if err != nil {
+			logs.GetLogger().Error(err)
+			return nil, err
+		}
+
+		customTransport := http.DefaultTransport.(*http.Transport).Clone()
+		customTransport.TLSClientConfig = tlsConfig
+		transport = customTransport
+	}
+
+	client := &Client{
+		httpClient:  &http.Client{Transport: transport},
+		retryPolicy: config.RetryPolicy,
+	}
+
+	if config.TimeoutSecond > 0 {
+		client.httpClient.Timeout = time.Duration(config.TimeoutSecond) * time.Second
+	}
+
+	return client, nil
+}
+
+func getTlsConfig(config ClientConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{}
+	if config.TLSConfig != nil {
+		tlsConfig = config.TLSConfig.Clone()
+	}
+
+	if config.InsecureSkipVerify {
+		tlsConfig.InsecureSkipVerify = true
+	}
+
+	if config.CaCertFile == "" && len(config.CaCertPem) == 0 {
+		return tlsConfig, nil
+	}
+
+	if tlsConfig.RootCAs == nil {
+		rootCAs, err := x509.SystemCertPool()
+		if err != nil || rootCAs == nil {
+			rootCAs = x509.NewCertPool()
+		}
+		tlsConfig.RootCAs = rootCAs
+	}
+
+	if config.CaCertFile != "" {
+		caCertPem, err := ioutil.ReadFile(config.CaCertFile)
+		if err != nil {
+			logs.GetLogger().Error(err)
+			return nil, err
+		}
+
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(caCertPem) {
+			err := fmt.Errorf("no certificate found in ca cert file:%s", config.CaCertFile)
+			logs.GetLogger().Error(err)
+			return nil, err
+		}
+	}
+
+	if len(config.CaCertPem) > 0 {
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(config.CaCertPem) {
+			err := fmt.Errorf("no certificate found in ca cert pem")
+			logs.GetLogger().Error(err)
+			return nil, err
+		}
+	}
+
+	return tlsConfig, nil
+}
+
+//the default client keeps the historical behavior of this package: tls verification is skipped
+func GetDefaultClient() *Client {
+	defaultClientMutex.RLock()
+	client := defaultClient
+	defaultClientMutex.RUnlock()
+	if client != nil {
+		return client
+	}
+
+	defaultClientMutex.Lock()
+	defer defaultClientMutex.Unlock()
+	if defaultClient == nil {
+		defaultClient, _ = GetClient(ClientConfig{InsecureSkipVerify: true})
+	}
+
+	return defaultClient
+}
+
+//replaces the client used by HttpGet, HttpPost, etc.
+func SetDefaultClient(client *Client) {
+	defaultClientMutex.Lock()
+	defer defaultClientMutex.Unlock()
+	defaultClient = client
+}
+
+func (client *Client) HttpClient() *http.Client {
+	return client.httpClient
+}
+
+//returns a client sharing the same transport but using the given retry policy,
+//a nil policy keeps the policy of the current client
+func (client *Client) WithRetryPolicy(policy *RetryPolicy) *Client {
+	if policy == nil {
+		return client
+	}
+
+	return &Client{
+		httpClient:  client.httpClient,
+		retryPolicy: policy,
+	}
+}
+
+func (client *Client) RetryPolicy() *RetryPolicy {
+	return client.retryPolicy
+}
+
+func (client *Client) Get(ctx context.Context, uri, tokenString string, params interface{}) ([]byte, error) {
+	return client.Request(ctx, http.MethodGet, uri, tokenString, params)
+}
+
+func (client *Client) Post(ctx context.Context, uri, tokenString string, params interface{}) ([]byte, error) {
+	return client.Request(ctx, http.MethodPost, uri, tokenString, params)
+}
+
+func (client *Client) Put(ctx context.Context, uri, tokenString string, params interface{}) ([]byte, error) {
+	return client.Request(ctx, http.MethodPut, uri, tokenString, params)
+}
+
+func (client *Client) Delete(ctx context.Context, uri, tokenString string, params interface{}) ([]byte, error) {
+	return client.Request(ctx, http.MethodDelete, uri, tokenString, params)
+}
+
+func (client *Client) Request(ctx context.Context, httpMethod, uri, tokenString string, params interface{}) ([]byte, error) {
+	retryable := client.retryPolicy.retriesMethod(httpMethod)
+	newRequest, err := getRequestFactory(ctx, httpMethod, uri, tokenString, params, retryable)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	if !retryable {
+		request, err := newRequest()
+		if err != nil {
+			logs.GetLogger().Error(err)
+			return nil, err
+		}
+
+		return client.Do(request)
+	}
+
+	var response []byte
+	err = client.retryPolicy.Do(ctx, func() error {
+		request, err := newRequest()
+		if err != nil {
+			logs.GetLogger().Error(err)
+			return err
+		}
+
+		response, err = client.Do(request)
+		return err
+	})
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	return response, nil
+}
+
+//io.Reader params are sent as form and streamed, others are encoded as json
+func NewRequest(ctx context.Context, httpMethod, uri, tokenString string, params interface{}) (*http.Request, error) {
+	if reader, ok := params.(io.Reader); ok {
+		return newRequestFromReader(ctx, httpMethod, uri, tokenString, reader, HTTP_CONTENT_TYPE_FORM)
+	}
+
+	body, err := json.Marshal(params)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	return newRequestFromReader(ctx, httpMethod, uri, tokenString, bytes.NewReader(body), HTTP_CONTENT_TYPE_JSON)
+}
+
+//returns a function building the request from params, an io.Reader param can be read only once,
+//so it is buffered in memory when the request can be retried and streamed otherwise
+func getRequestFactory(ctx context.Context, httpMethod, uri, tokenString string, params interface{}, retryable bool) (func() (*http.Request, error), error) {
+	_, isReader := params.(io.Reader)
+	if isReader && !retryable {
+		newRequest := func() (*http.Request, error) {
+			return NewRequest(ctx, httpMethod, uri, tokenString, params)
+		}
+		return newRequest, nil
+	}
+
+	body, contentType, err := getRequestBody(params)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	newRequest := func() (*http.Request, error) {
+		return newRequestFromReader(ctx, httpMethod, uri, tokenString, bytes.NewReader(body), contentType)
+	}
+	return newRequest, nil
+}
+
+//io.Reader params are read into memory and sent as form, others are encoded as json
+func getRequestBody(params interface{}) ([]byte, string, error) {
+	switch params := params.(type) {
+	case io.Reader:
+		body, err := ioutil.ReadAll(params)
+		if err != nil {
+			logs.GetLogger().Error(err)
+			return nil, "", err
+		}
+		return body, HTTP_CONTENT_TYPE_FORM, nil
+	default:
+		body, err := json.Marshal(params)
+		if err != nil {
+			logs.GetLogger().Error(err)
+			return nil, "", err
+		}
+		return body, HTTP_CONTENT_TYPE_JSON, nil
+	}
+}
+
+func newRequestFromReader(ctx context.Context, httpMethod, uri, tokenString string, body io.Reader, contentType string) (*http.Request, error) {
+	request, err := http.NewRequestWithContext(ctx, httpMethod, uri, body)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	request.Header.Set("Content-Type", contentType)
+	setToken(request, tokenString)
+
+	return request, nil
+}
+
+func setToken(request *http.Request, tokenString string) {
+	if len(strings.Trim(tokenString, " ")) > 0 {
+		request.Header.Set("Authorization", "Bearer "+tokenString)
+	}
+}
+
+//sends the request, checks the http status and returns the whole response body
+func (client *Client) Do(request *http.Request) ([]byte, error) {
+	response, err := client.httpClient.Do(request)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	defer response.Body.Close()
+
+	err = checkResponseStatus(request, response)
+	if err != nil {
+		return nil, err
+	}
+
+	responseBody, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	return responseBody, nil
+}
+
+func checkResponseStatus(request *http.Request, response *http.Response) error {
+	if response.StatusCode == http.StatusOK {
+		return nil
+	}
+
+	uri := request.URL.String()
+	message, _ := ioutil.ReadAll(io.LimitReader(response.Body, HTTP_ERROR_MESSAGE_MAX_LENGTH))
+	err := &HTTPStatusError{
+		StatusCode: response.StatusCode,
+		Status:     response.Status,
+		Url:        uri,
+		Message:    strings.TrimSpace(string(message)),
+		RetryAfter: getRetryAfter(response),
+	}
+	logs.GetLogger().Error(err)
+	switch response.StatusCode {
+	case http.StatusNotFound:
+		logs.GetLogger().Error("please check your url:", uri)
+	case http.StatusUnauthorized:
+		logs.GetLogger().Error("Please check your token")
+	}
+
+	return err
+}
+
+//the file is streamed instead of being loaded in memory
+func (client *Client) RequestFile(ctx context.Context, httpMethod, uri, tokenString string, paramTexts map[string]string, paramFilename, paramFilepath string) ([]byte, error) {
+	fileInfo, err := os.Stat(paramFilepath)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	if !fileInfo.Mode().IsRegular() {
+		err := fmt.Errorf("%s is not a regular file", paramFilepath)
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	multipartOptions := &MultipartOptions{
+		Fields: paramTexts,
+		Files: []*MultipartFile{
+			{
+				FieldName: paramFilename,
+				FileName:  fileInfo.Name(),
+				Filepath:  paramFilepath,
+				Size:      fileInfo.Size(),
+			},
+		},
+	}
+
+	return client.RequestMultipart(ctx, httpMethod, uri, tokenString, multipartOptions)
+}
@@ -0,0 +1,44 @@
+package web
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+const HTTP_ERROR_MESSAGE_MAX_LENGTH = 1024
+
+var (
+	ErrUnauthorized           = errors.New("unauthorized")
+	ErrInsufficientPermission = errors.New("insufficient permission")
+	ErrNotFound               = errors.New("not found")
+)
+
+type HTTPStatusError struct {
+	StatusCode int
+	Status     string
+	Url        string
+	Message    string        // beginning of the response body
+	RetryAfter time.Duration // from Retry-After header, 0 when absent
+}
+
+func (e *HTTPStatusError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("http status: %s, code:%d, url:%s", e.Status, e.StatusCode, e.Url)
+	}
+
+	return fmt.Sprintf("http status: %s, code:%d, url:%s, message:%s", e.Status, e.StatusCode, e.Url, e.Message)
+}
+
+func (e *HTTPStatusError) Is(target error) bool {
+	switch target {
+	case ErrUnauthorized:
+		return e.StatusCode == 401
+	case ErrInsufficientPermission:
+		return e.StatusCode == 403
+	case ErrNotFound:
+		return e.StatusCode == 404
+	default:
+		return false
+	}
+}
@@ -0,0 +1,214 @@
+package web
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/filswan/go-swan-lib/logs"
+)
+
+const (
+	MULTIPART_FIELD_NAME_FILE_DEFAULT = "file"
+	HTTP_CONTENT_TYPE_OCTET_STREAM    = "application/octet-stream"
+	HTTP_CONTENT_TYPE_DIRECTORY       = "application/x-directory" // part of a directory entry, as ipfs add expects
+)
+
+//a file or a directory entry sent as a part, directory entries have an empty Filepath
+type MultipartFile struct {
+	FieldName   string // MULTIPART_FIELD_NAME_FILE_DEFAULT when empty
+	FileName    string // sent as is, the relative path with / for entries of a directory
+	Filepath    string // local file to stream, empty for a directory entry
+	ContentType string // HTTP_CONTENT_TYPE_OCTET_STREAM, or HTTP_CONTENT_TYPE_DIRECTORY for a directory entry, when empty
+	Size        int64  // size of the local file, for progress
+}
+
+type MultipartOptions struct {
+	Fields   map[string]string
+	Files    []*MultipartFile
+	Progress ProgressFunc // called with the file bytes sent and the total size of the files
+}
+
+//returns the parts of a file, or of a directory and everything under it, the directory itself coming before its entries,
+//file names are relative to the parent of srcPath
+func GetMultipartFiles(fieldName, srcPath string) ([]*MultipartFile, error) {
+	srcPath = filepath.Clean(srcPath)
+	parentDir := filepath.Dir(srcPath)
+
+	multipartFiles := []*MultipartFile{}
+	err := filepath.Walk(srcPath, func(walkPath string, fileInfo os.FileInfo, err error) error {
+		if err != nil {
+			logs.GetLogger().Error(err)
+			return err
+		}
+
+		relPath, err := filepath.Rel(parentDir, walkPath)
+		if err != nil {
+			logs.GetLogger().Error(err)
+			return err
+		}
+
+		multipartFile := &MultipartFile{
+			FieldName: fieldName,
+			FileName:  filepath.ToSlash(relPath),
+		}
+
+		switch {
+		case fileInfo.IsDir():
+			multipartFile.ContentType = HTTP_CONTENT_TYPE_DIRECTORY
+		case fileInfo.Mode().IsRegular():
+			multipartFile.Filepath = walkPath
+			multipartFile.Size = fileInfo.Size()
+		default:
+			logs.GetLogger().Warn("skip ", walkPath, ", it is neither a file nor a directory")
+			return nil
+		}
+
+		multipartFiles = append(multipartFiles, multipartFile)
+		return nil
+	})
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	return multipartFiles, nil
+}
+
+//sends the fields and the files as multipart/form-data, the files are streamed instead of being loaded in memory,
+//the request is not retried as its body cannot be replayed
+func (client *Client) RequestMultipart(ctx context.Context, httpMethod, uri, tokenString string, multipartOptions *MultipartOptions) ([]byte, error) {
+	request, err := NewMultipartRequest(ctx, httpMethod, uri, tokenString, multipartOptions)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	return client.Do(request)
+}
+
+//the body is written by a goroutine as the request is sent
+func NewMultipartRequest(ctx context.Context, httpMethod, uri, tokenString string, multipartOptions *MultipartOptions) (*http.Request, error) {
+	if multipartOptions == nil {
+		multipartOptions = &MultipartOptions{}
+	}
+
+	pipeReader, pipeWriter := io.Pipe()
+	bodyWriter := multipart.NewWriter(pipeWriter)
+
+	request, err := http.NewRequestWithContext(ctx, httpMethod, uri, pipeReader)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	request.Header.Set("Content-Type", bodyWriter.FormDataContentType())
+	setToken(request, tokenString)
+
+	go func() {
+		err := writeMultipartBody(bodyWriter, multipartOptions)
+		if err == nil {
+			err = bodyWriter.Close()
+		}
+		pipeWriter.CloseWithError(err)
+	}()
+
+	return request, nil
+}
+
+func writeMultipartBody(bodyWriter *multipart.Writer, multipartOptions *MultipartOptions) error {
+	for key, val := range multipartOptions.Fields {
+		err := bodyWriter.WriteField(key, val)
+		if err != nil {
+			logs.GetLogger().Error(err)
+			return err
+		}
+	}
+
+	var totalBytes int64
+	for _, multipartFile := range multipartOptions.Files {
+		totalBytes += multipartFile.Size
+	}
+
+	writer := &progressWriter{
+		totalBytes: totalBytes,
+		progress:   multipartOptions.Progress,
+	}
+
+	for _, multipartFile := range multipartOptions.Files {
+		partWriter, err := createFilePart(bodyWriter, multipartFile)
+		if err != nil {
+			logs.GetLogger().Error(err)
+			return err
+		}
+
+		if multipartFile.Filepath == "" {
+			continue
+		}
+
+		writer.writer = partWriter
+		err = copyFile(writer, multipartFile.Filepath)
+		if err != nil {
+			logs.GetLogger().Error(err)
+			return err
+		}
+	}
+
+	return nil
+}
+
+func createFilePart(bodyWriter *multipart.Writer, multipartFile *MultipartFile) (io.Writer, error) {
+	fieldName := multipartFile.FieldName
+	if fieldName == "" {
+		fieldName = MULTIPART_FIELD_NAME_FILE_DEFAULT
+	}
+
+	contentType := multipartFile.ContentType
+	if contentType == "" {
+		contentType = HTTP_CONTENT_TYPE_OCTET_STREAM
+		if multipartFile.Filepath == "" {
+			contentType = HTTP_CONTENT_TYPE_DIRECTORY
+		}
+	}
+
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"; filename="%s"`, escapeQuotes(fieldName), escapeQuotes(multipartFile.FileName)))
+	header.Set("Content-Type", contentType)
+
+	return bodyWriter.CreatePart(header)
+}
+
+var quoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
+
+func escapeQuotes(s string) string {
+	return quoteEscaper.Replace(s)
+}
+
+func copyFile(writer io.Writer, filepath string) error {
+	file, err := os.Open(filepath)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+	defer file.Close()
+
+	_, err = io.CopyBuffer(writer, file, make([]byte, DOWNLOAD_BUFFER_SIZE))
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return err
+	}
+
+	return nil
+}
+
+//returns the last line of a newline delimited response, such as the one of ipfs add
+func getLastLine(response []byte) []byte {
+	lines := strings.Split(strings.TrimSpace(string(response)), "\n")
+	return []byte(strings.TrimSpace(lines[len(lines)-1]))
+}
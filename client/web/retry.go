@@ -0,0 +1,209 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/filswan/go-swan-lib/logs"
+)
+
+const (
+	RETRY_MAX_ATTEMPTS_DEFAULT         = 3
+	RETRY_INITIAL_INTERVAL_DEFAULT     = 500 * time.Millisecond
+	RETRY_MAX_INTERVAL_DEFAULT         = 30 * time.Second
+	RETRY_MULTIPLIER_DEFAULT           = 2
+	RETRY_RANDOMIZATION_FACTOR_DEFAULT = 0.5
+	RETRY_MAX_ELAPSED_TIME_DEFAULT     = 2 * time.Minute
+)
+
+type RetryPolicy struct {
+	MaxAttempts         int                  // including the first attempt, 0 means no limit other than MaxElapsedTime
+	InitialInterval     time.Duration        // delay before the first retry
+	MaxInterval         time.Duration        // upper bound of a single delay, 0 means no bound
+	Multiplier          float64              // growth of the delay after each retry, values below 1 are treated as 1
+	RandomizationFactor float64              // jitter, 0.5 means the delay is picked in [0.5*delay, 1.5*delay]
+	MaxElapsedTime      time.Duration        // no retry is started after this time since the first attempt, 0 means no limit
+	RetryNonIdempotent  bool                 // when false, web.Client retries only GET, HEAD, OPTIONS, PUT and DELETE requests
+	IsRetryable         func(err error) bool // when nil, IsRetryableError is used
+}
+
+func DefaultRetryPolicy() *RetryPolicy {
+	return &RetryPolicy{
+		MaxAttempts:         RETRY_MAX_ATTEMPTS_DEFAULT,
+		InitialInterval:     RETRY_INITIAL_INTERVAL_DEFAULT,
+		MaxInterval:         RETRY_MAX_INTERVAL_DEFAULT,
+		Multiplier:          RETRY_MULTIPLIER_DEFAULT,
+		RandomizationFactor: RETRY_RANDOMIZATION_FACTOR_DEFAULT,
+		MaxElapsedTime:      RETRY_MAX_ELAPSED_TIME_DEFAULT,
+	}
+}
+
+//connection resets/refusals, timeouts, unexpected EOF, 408, 429 and 5xx except 501 and 505 are retryable
+func IsRetryableError(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	var httpStatusError *HTTPStatusError
+	if errors.As(err, &httpStatusError) {
+		switch httpStatusError.StatusCode {
+		case http.StatusRequestTimeout, http.StatusTooManyRequests:
+			return true
+		case http.StatusNotImplemented, http.StatusHTTPVersionNotSupported:
+			return false
+		}
+		return httpStatusError.StatusCode >= http.StatusInternalServerError
+	}
+
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	if errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.ECONNABORTED) ||
+		errors.Is(err, syscall.EPIPE) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+
+	var netError net.Error
+	if errors.As(err, &netError) && netError.Timeout() {
+		return true
+	}
+
+	return false
+}
+
+func (policy *RetryPolicy) isRetryable(err error) bool {
+	if policy.IsRetryable != nil {
+		return policy.IsRetryable(err)
+	}
+
+	return IsRetryableError(err)
+}
+
+//whether a request with httpMethod can be sent more than once by the policy
+func (policy *RetryPolicy) retriesMethod(httpMethod string) bool {
+	if policy == nil || policy.MaxAttempts == 1 {
+		return false
+	}
+
+	if policy.RetryNonIdempotent {
+		return true
+	}
+
+	switch httpMethod {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	default:
+		return false
+	}
+}
+
+//delay before the retry following the given attempt, attempt starts from 1
+func (policy *RetryPolicy) getInterval(attempt int) time.Duration {
+	multiplier := policy.Multiplier
+	if multiplier < 1 {
+		multiplier = 1
+	}
+
+	interval := float64(policy.InitialInterval)
+	for i := 1; i < attempt; i++ {
+		interval = interval * multiplier
+		if policy.MaxInterval > 0 && interval > float64(policy.MaxInterval) {
+			interval = float64(policy.MaxInterval)
+			break
+		}
+	}
+
+	if policy.RandomizationFactor > 0 {
+		delta := policy.RandomizationFactor * interval
+		interval = interval - delta + rand.Float64()*(2*delta)
+	}
+
+	if policy.MaxInterval > 0 && interval > float64(policy.MaxInterval) {
+		interval = float64(policy.MaxInterval)
+	}
+
+	return time.Duration(interval)
+}
+
+//runs operation until it succeeds, returns a non retryable error, or the policy is exhausted,
+//a nil policy runs operation only once
+func (policy *RetryPolicy) Do(ctx context.Context, operation func() error) error {
+	if policy == nil {
+		return operation()
+	}
+
+	startTime := time.Now()
+	for attempt := 1; ; attempt++ {
+		err := operation()
+		if err == nil {
+			return nil
+		}
+
+		if ctx.Err() != nil || !policy.isRetryable(err) {
+			return err
+		}
+
+		if policy.MaxAttempts > 0 && attempt >= policy.MaxAttempts {
+			return err
+		}
+
+		interval := policy.getInterval(attempt)
+		var httpStatusError *HTTPStatusError
+		if errors.As(err, &httpStatusError) && httpStatusError.RetryAfter > interval {
+			interval = httpStatusError.RetryAfter
+		}
+
+		if policy.MaxElapsedTime > 0 && time.Since(startTime)+interval > policy.MaxElapsedTime {
+			return err
+		}
+
+		logs.GetLogger().Info("attempt ", attempt, " failed, retry in ", interval, ", error:", err)
+
+		timer := time.NewTimer(interval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
+
+func getRetryAfter(response *http.Response) time.Duration {
+	retryAfter := response.Header.Get("Retry-After")
+	if retryAfter == "" {
+		return 0
+	}
+
+	seconds, err := strconv.Atoi(retryAfter)
+	if err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+
+	retryTime, err := http.ParseTime(retryAfter)
+	if err != nil {
+		return 0
+	}
+
+	interval := time.Until(retryTime)
+	if interval < 0 {
+		return 0
+	}
+
+	return interval
+}
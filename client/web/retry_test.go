@@ -0,0 +1,162 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicyGetInterval(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   RetryPolicy
+		attempt  int
+		interval time.Duration
+	}{
+		{"first attempt", RetryPolicy{InitialInterval: time.Second, Multiplier: 2}, 1, time.Second},
+		{"second attempt", RetryPolicy{InitialInterval: time.Second, Multiplier: 2}, 2, 2 * time.Second},
+		{"fourth attempt", RetryPolicy{InitialInterval: time.Second, Multiplier: 2}, 4, 8 * time.Second},
+		{"fractional multiplier", RetryPolicy{InitialInterval: time.Second, Multiplier: 1.5}, 3, 2250 * time.Millisecond},
+		{"multiplier below 1", RetryPolicy{InitialInterval: time.Second, Multiplier: 0.5}, 5, time.Second},
+		{"capped by max interval", RetryPolicy{InitialInterval: time.Second, Multiplier: 2, MaxInterval: 5 * time.Second}, 4, 5 * time.Second},
+		{"many attempts capped", RetryPolicy{InitialInterval: time.Second, Multiplier: 2, MaxInterval: 30 * time.Second}, 1000, 30 * time.Second},
+		{"initial interval above max interval", RetryPolicy{InitialInterval: time.Minute, Multiplier: 2, MaxInterval: 30 * time.Second}, 1, 30 * time.Second},
+		{"no max interval", RetryPolicy{InitialInterval: time.Millisecond, Multiplier: 10}, 4, time.Second},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			interval := test.policy.getInterval(test.attempt)
+			if interval != test.interval {
+				t.Errorf("getInterval(%d) = %s, want %s", test.attempt, interval, test.interval)
+			}
+		})
+	}
+}
+
+func TestRetryPolicyGetIntervalRandomized(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  RetryPolicy
+		attempt int
+		min     time.Duration
+		max     time.Duration
+	}{
+		{"jitter of half", RetryPolicy{InitialInterval: time.Second, Multiplier: 2, RandomizationFactor: 0.5}, 2, time.Second, 3 * time.Second},
+		{"jitter capped by max interval", RetryPolicy{InitialInterval: time.Second, Multiplier: 2, RandomizationFactor: 0.5, MaxInterval: 4 * time.Second}, 3, 2 * time.Second, 4 * time.Second},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			for i := 0; i < 1000; i++ {
+				interval := test.policy.getInterval(test.attempt)
+				if interval < test.min || interval > test.max {
+					t.Fatalf("getInterval(%d) = %s, want in [%s, %s]", test.attempt, interval, test.min, test.max)
+				}
+			}
+		})
+	}
+}
+
+func TestGetRetryAfter(t *testing.T) {
+	tests := []struct {
+		name       string
+		retryAfter string
+		min        time.Duration
+		max        time.Duration
+	}{
+		{"absent", "", 0, 0},
+		{"seconds", "3", 3 * time.Second, 3 * time.Second},
+		{"zero seconds", "0", 0, 0},
+		{"negative seconds", "-1", 0, 0},
+		{"invalid", "soon", 0, 0},
+		{"http date", time.Now().Add(10 * time.Second).UTC().Format(http.TimeFormat), 8 * time.Second, 10 * time.Second},
+		{"http date in the past", time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat), 0, 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			response := &http.Response{Header: http.Header{}}
+			if test.retryAfter != "" {
+				response.Header.Set("Retry-After", test.retryAfter)
+			}
+
+			retryAfter := getRetryAfter(response)
+			if retryAfter < test.min || retryAfter > test.max {
+				t.Errorf("getRetryAfter(%q) = %s, want in [%s, %s]", test.retryAfter, retryAfter, test.min, test.max)
+			}
+		})
+	}
+}
+
+func TestClientRequestRetry(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		statuses   []int
+		retryAfter string
+		attempts   int32
+		minElapsed time.Duration
+		fail       bool
+	}{
+		{"success", http.MethodGet, []int{http.StatusOK}, "", 1, 0, false},
+		{"retried after 503", http.MethodGet, []int{http.StatusServiceUnavailable, http.StatusOK}, "", 2, 0, false},
+		{"retry after header honored", http.MethodGet, []int{http.StatusTooManyRequests, http.StatusOK}, "1", 2, time.Second, false},
+		{"exhausted", http.MethodGet, []int{http.StatusBadGateway, http.StatusBadGateway, http.StatusBadGateway, http.StatusOK}, "", 3, 0, true},
+		{"not retryable status", http.MethodGet, []int{http.StatusBadRequest, http.StatusOK}, "", 1, 0, true},
+		{"post not retried", http.MethodPost, []int{http.StatusServiceUnavailable, http.StatusOK}, "", 1, 0, true},
+		{"put retried", http.MethodPut, []int{http.StatusServiceUnavailable, http.StatusOK}, "", 2, 0, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var attempts int32
+			server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+				attempt := atomic.AddInt32(&attempts, 1)
+				status := test.statuses[attempt-1]
+				if status != http.StatusOK && test.retryAfter != "" {
+					writer.Header().Set("Retry-After", test.retryAfter)
+				}
+				writer.WriteHeader(status)
+				writer.Write([]byte(`{"status":"success"}`))
+			}))
+			defer server.Close()
+
+			client, err := GetClient(ClientConfig{
+				RetryPolicy: &RetryPolicy{
+					MaxAttempts:     3,
+					InitialInterval: time.Millisecond,
+					Multiplier:      2,
+				},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			startTime := time.Now()
+			_, err = client.Request(context.Background(), test.method, server.URL, "", map[string]string{"key": "value"})
+			elapsed := time.Since(startTime)
+
+			if (err != nil) != test.fail {
+				t.Errorf("error = %v, want failure %t", err, test.fail)
+			}
+
+			var httpStatusError *HTTPStatusError
+			if err != nil && !errors.As(err, &httpStatusError) {
+				t.Errorf("error = %v, want *HTTPStatusError", err)
+			}
+
+			if attempts != test.attempts {
+				t.Errorf("attempts = %d, want %d", attempts, test.attempts)
+			}
+
+			if elapsed < test.minElapsed {
+				t.Errorf("elapsed = %s, want at least %s", elapsed, test.minElapsed)
+			}
+		})
+	}
+}
@@ -0,0 +1,191 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/filswan/go-swan-lib/logs"
+)
+
+const (
+	DOWNLOAD_PART_FILE_SUFFIX = ".part"
+	DOWNLOAD_BUFFER_SIZE      = 1024 * 1024
+	HTTP_HEADER_STREAM_ERROR  = "X-Stream-Error" // trailer set by ipfs when an error happens after the body started
+)
+
+var ErrSizeMismatch = errors.New("size mismatch")
+
+//bytesWritten includes the bytes of a resumed partial file, totalBytes is -1 when unknown
+type ProgressFunc func(bytesWritten, totalBytes int64)
+
+type StreamOptions struct {
+	Progress     ProgressFunc // called after each chunk written
+	ExpectedSize int64        // verified when greater than 0
+	Resume       bool         // continue from the partial file left by a previous call
+}
+
+//streams the response body to destFilepath without holding it in memory,
+//the data is written to destFilepath.part which is renamed once complete,
+//it is kept on failure so that a later call with Resume continues from it,
+//a partial file is continued by a range request, or by skipping the bytes already written when the server ignores the range,
+//retried attempts always continue from the partial file
+func (client *Client) DownloadFile(ctx context.Context, httpMethod, uri, tokenString string, params interface{}, destFilepath string, streamOptions *StreamOptions) (int64, error) {
+	if streamOptions == nil {
+		streamOptions = &StreamOptions{}
+	}
+
+	retryable := client.retryPolicy.retriesMethod(httpMethod)
+	newRequest, err := getRequestFactory(ctx, httpMethod, uri, tokenString, params, retryable)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return 0, err
+	}
+
+	partFilepath := destFilepath + DOWNLOAD_PART_FILE_SUFFIX
+	resume := streamOptions.Resume
+	var size int64
+	download := func() error {
+		request, err := newRequest()
+		if err != nil {
+			logs.GetLogger().Error(err)
+			return err
+		}
+
+		size, err = client.downloadPart(request, partFilepath, resume, streamOptions)
+		resume = true
+		return err
+	}
+
+	if retryable {
+		err = client.retryPolicy.Do(ctx, download)
+	} else {
+		err = download()
+	}
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return 0, err
+	}
+
+	if streamOptions.ExpectedSize > 0 && size != streamOptions.ExpectedSize {
+		err := fmt.Errorf("%s, size:%d, expected:%d, %w", uri, size, streamOptions.ExpectedSize, ErrSizeMismatch)
+		logs.GetLogger().Error(err)
+		os.Remove(partFilepath)
+		return 0, err
+	}
+
+	err = os.Rename(partFilepath, destFilepath)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return 0, err
+	}
+
+	return size, nil
+}
+
+//returns the size of the partial file after the response is written to it
+func (client *Client) downloadPart(request *http.Request, partFilepath string, resume bool, streamOptions *StreamOptions) (int64, error) {
+	flag := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if resume {
+		flag = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	}
+
+	partFile, err := os.OpenFile(partFilepath, flag, 0644)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return 0, err
+	}
+	defer partFile.Close()
+
+	fileInfo, err := partFile.Stat()
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return 0, err
+	}
+
+	offset := fileInfo.Size()
+	if offset > 0 {
+		request.Header.Set("Range", "bytes="+strconv.FormatInt(offset, 10)+"-")
+	}
+
+	response, err := client.httpClient.Do(request)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return offset, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode == http.StatusRequestedRangeNotSatisfiable && streamOptions.ExpectedSize > 0 && offset == streamOptions.ExpectedSize {
+		return offset, nil
+	}
+
+	if response.StatusCode != http.StatusPartialContent {
+		err = checkResponseStatus(request, response)
+		if err != nil {
+			return offset, err
+		}
+
+		if offset > 0 {
+			_, err = io.CopyN(ioutil.Discard, response.Body, offset)
+			if err != nil {
+				logs.GetLogger().Error(err)
+				return offset, err
+			}
+		}
+	}
+
+	totalBytes := streamOptions.ExpectedSize
+	if totalBytes <= 0 {
+		totalBytes = -1
+		if response.ContentLength >= 0 {
+			totalBytes = response.ContentLength
+			if response.StatusCode == http.StatusPartialContent {
+				totalBytes += offset
+			}
+		}
+	}
+
+	writer := &progressWriter{
+		writer:       partFile,
+		bytesWritten: offset,
+		totalBytes:   totalBytes,
+		progress:     streamOptions.Progress,
+	}
+
+	_, err = io.CopyBuffer(writer, response.Body, make([]byte, DOWNLOAD_BUFFER_SIZE))
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return writer.bytesWritten, err
+	}
+
+	streamError := response.Trailer.Get(HTTP_HEADER_STREAM_ERROR)
+	if streamError != "" {
+		err := fmt.Errorf("%s, stream error:%s", request.URL.String(), streamError)
+		logs.GetLogger().Error(err)
+		return writer.bytesWritten, err
+	}
+
+	return writer.bytesWritten, nil
+}
+
+type progressWriter struct {
+	writer       io.Writer
+	bytesWritten int64
+	totalBytes   int64
+	progress     ProgressFunc
+}
+
+func (progressWriter *progressWriter) Write(p []byte) (int, error) {
+	n, err := progressWriter.writer.Write(p)
+	progressWriter.bytesWritten += int64(n)
+	if progressWriter.progress != nil {
+		progressWriter.progress(progressWriter.bytesWritten, progressWriter.totalBytes)
+	}
+
+	return n, err
+}
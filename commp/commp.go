@@ -0,0 +1,247 @@
+package commp
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"math/bits"
+	"os"
+
+	"github.com/filswan/go-swan-lib/logs"
+
+	"github.com/ipfs/go-cid"
+	"github.com/multiformats/go-multihash"
+)
+
+const (
+	FIL_COMMITMENT_UNSEALED  = 0xf101 // cid codec of piece cid
+	SHA2_256_TRUNC254_PADDED = 0x1012 // multihash code of piece cid
+	NODE_SIZE                = 32
+	QUAD_PAYLOAD_SIZE        = 127 // unpadded bytes expanded to one fr32 quad
+	QUAD_SIZE                = 128
+	MIN_PIECE_PAYLOAD_SIZE   = 65 // fr32 padding is not defined for less data
+	MIN_PIECE_SIZE           = 128
+	MAX_LAYERS               = 50 // enough for pieces up to 32 PiB
+	COMMP_READ_BUFFER_SIZE   = 4 * 1024 * 1024
+)
+
+//zeroCommitments[i] is the root of a tree of 2^i zero nodes
+var zeroCommitments [MAX_LAYERS][]byte
+
+func init() {
+	zeroCommitments[0] = make([]byte, NODE_SIZE)
+	for i := 1; i < MAX_LAYERS; i++ {
+		zeroCommitments[i] = hashNodes(zeroCommitments[i-1], zeroCommitments[i-1])
+	}
+}
+
+type PieceCommitment struct {
+	PieceCid    string
+	Commitment  []byte // 32 bytes merkle root
+	PieceSize   int64  // padded piece size, a power of 2
+	PayloadSize int64  // bytes read
+}
+
+//computes the piece commitment of the data written to it, like a hash.Hash
+type Calculator struct {
+	payloadSize int64
+	quad        [QUAD_PAYLOAD_SIZE]byte
+	quadLength  int
+	layers      [MAX_LAYERS][]byte // pending left node of each layer
+}
+
+func GetCalculator() *Calculator {
+	return &Calculator{}
+}
+
+func (calculator *Calculator) Reset() {
+	*calculator = Calculator{}
+}
+
+func (calculator *Calculator) Write(data []byte) (int, error) {
+	length := len(data)
+	calculator.payloadSize += int64(length)
+
+	if calculator.quadLength > 0 {
+		copied := copy(calculator.quad[calculator.quadLength:], data)
+		calculator.quadLength += copied
+		data = data[copied:]
+		if calculator.quadLength < QUAD_PAYLOAD_SIZE {
+			return length, nil
+		}
+		calculator.addQuad(calculator.quad[:])
+		calculator.quadLength = 0
+	}
+
+	for len(data) >= QUAD_PAYLOAD_SIZE {
+		calculator.addQuad(data[:QUAD_PAYLOAD_SIZE])
+		data = data[QUAD_PAYLOAD_SIZE:]
+	}
+
+	calculator.quadLength = copy(calculator.quad[:], data)
+
+	return length, nil
+}
+
+//the calculator can still be written after Digest, the result then covers all the data written
+func (calculator *Calculator) Digest() (*PieceCommitment, error) {
+	if calculator.payloadSize < MIN_PIECE_PAYLOAD_SIZE {
+		err := fmt.Errorf("at least %d bytes are required to calculate piece commitment, got:%d", MIN_PIECE_PAYLOAD_SIZE, calculator.payloadSize)
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	layers := calculator.layers
+	quadCount := calculator.payloadSize / QUAD_PAYLOAD_SIZE
+	if calculator.quadLength > 0 {
+		var quad [QUAD_PAYLOAD_SIZE]byte
+		copy(quad[:], calculator.quad[:calculator.quadLength])
+		var paddedQuad [QUAD_SIZE]byte
+		fr32Pad(quad[:], paddedQuad[:])
+		for i := 0; i < QUAD_SIZE; i += NODE_SIZE {
+			addNode(&layers, append([]byte{}, paddedQuad[i:i+NODE_SIZE]...), 0)
+		}
+		quadCount++
+	}
+
+	pieceSize := GetPaddedPieceSize(quadCount * QUAD_SIZE)
+	depth := bits.TrailingZeros64(uint64(pieceSize / NODE_SIZE))
+	for layer := 0; layer < depth; layer++ {
+		if layers[layer] != nil {
+			node := hashNodes(layers[layer], zeroCommitments[layer])
+			layers[layer] = nil
+			addNode(&layers, node, layer+1)
+		}
+	}
+
+	commitment := layers[depth]
+	pieceCid, err := GetPieceCid(commitment)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	pieceCommitment := &PieceCommitment{
+		PieceCid:    pieceCid.String(),
+		Commitment:  commitment,
+		PieceSize:   pieceSize,
+		PayloadSize: calculator.payloadSize,
+	}
+
+	return pieceCommitment, nil
+}
+
+func (calculator *Calculator) addQuad(quad []byte) {
+	var paddedQuad [QUAD_SIZE]byte
+	fr32Pad(quad, paddedQuad[:])
+
+	for i := 0; i < QUAD_SIZE; i += NODE_SIZE {
+		leftNode := paddedQuad[i : i+NODE_SIZE]
+		i += NODE_SIZE
+		node := hashNodes(leftNode, paddedQuad[i:i+NODE_SIZE])
+		addNode(&calculator.layers, node, 1)
+	}
+}
+
+//node is the right sibling of the pending node of the layer if any
+func addNode(layers *[MAX_LAYERS][]byte, node []byte, layer int) {
+	for layers[layer] != nil {
+		node = hashNodes(layers[layer], node)
+		layers[layer] = nil
+		layer++
+	}
+
+	layers[layer] = node
+}
+
+//sha256 with the 2 most significant bits cleared, so the result fits in the bls12-381 field
+func hashNodes(leftNode, rightNode []byte) []byte {
+	hash := sha256.New()
+	hash.Write(leftNode)
+	hash.Write(rightNode)
+	node := hash.Sum(make([]byte, 0, NODE_SIZE))
+	node[NODE_SIZE-1] &= 0x3f
+	return node
+}
+
+//expands 127 bytes to 128 bytes by inserting 2 zero bits after every 254 bits
+func fr32Pad(in, out []byte) {
+	copy(out[:31], in[:31])
+	out[31] = in[31] & 0x3f
+
+	for i := 0; i < 32; i++ {
+		out[32+i] = in[31+i]>>6 | in[32+i]<<2
+	}
+	out[63] &= 0x3f
+
+	for i := 0; i < 32; i++ {
+		out[64+i] = in[63+i]>>4 | in[64+i]<<4
+	}
+	out[95] &= 0x3f
+
+	for i := 0; i < 31; i++ {
+		out[96+i] = in[95+i]>>2 | in[96+i]<<6
+	}
+	out[127] = in[126] >> 2
+}
+
+//the smallest power of 2 not less than size and MIN_PIECE_SIZE
+func GetPaddedPieceSize(size int64) int64 {
+	if size <= MIN_PIECE_SIZE {
+		return MIN_PIECE_SIZE
+	}
+
+	return int64(1) << bits.Len64(uint64(size-1))
+}
+
+//unpadded size, which is the max payload size of a piece
+func GetUnpaddedPieceSize(paddedPieceSize int64) int64 {
+	return paddedPieceSize - paddedPieceSize/QUAD_SIZE
+}
+
+func GetPieceCid(commitment []byte) (*cid.Cid, error) {
+	if len(commitment) != NODE_SIZE {
+		err := fmt.Errorf("commitment should be %d bytes, got:%d", NODE_SIZE, len(commitment))
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	hash, err := multihash.Encode(commitment, SHA2_256_TRUNC254_PADDED)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	pieceCid := cid.NewCidV1(FIL_COMMITMENT_UNSEALED, hash)
+	return &pieceCid, nil
+}
+
+//reads reader to its end
+func CalcCommP(reader io.Reader) (*PieceCommitment, error) {
+	calculator := GetCalculator()
+	buf := make([]byte, COMMP_READ_BUFFER_SIZE)
+	_, err := io.CopyBuffer(calculator, reader, buf)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	return calculator.Digest()
+}
+
+func CalcCommPFromFile(filepath string) (*PieceCommitment, error) {
+	file, err := os.Open(filepath)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+	defer file.Close()
+
+	pieceCommitment, err := CalcCommP(file)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return nil, err
+	}
+
+	return pieceCommitment, nil
+}
@@ -0,0 +1,131 @@
+package commp
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+//piece cids of the reference implementation github.com/filecoin-project/go-fil-commp-hashhash,
+//patterned data is byte(i*7) at offset i
+var pieceCommitmentVectors = []struct {
+	name       string
+	zero       bool
+	size       int
+	pieceSize  int64
+	commitment string
+	pieceCid   string
+}{
+	{"zero 65", true, 65, 128, "3731bb99ac689f66eef5973e4a94da188f4ddcae580724fc6f3fd60dfd488333", "baga6ea4seaqdomn3tgwgrh3g532zopskstnbrd2n3sxfqbze7rxt7vqn7veigmy"},
+	{"zero 127", true, 127, 128, "3731bb99ac689f66eef5973e4a94da188f4ddcae580724fc6f3fd60dfd488333", "baga6ea4seaqdomn3tgwgrh3g532zopskstnbrd2n3sxfqbze7rxt7vqn7veigmy"},
+	{"zero 128", true, 128, 256, "642a607ef886b004bf2c1978463ae1d4693ac0f410eb2d1b7a47fe205e5e750f", "baga6ea4seaqgiktap34inmaex4wbs6cghlq5i2j2yd2bb2zndn5ep7ralzphkdy"},
+	{"zero 1016", true, 1016, 1024, "1f7ac9595510e09ea41c460b176430bb322cd6fb412ec57cb17d989a4310372f", "baga6ea4seaqb66wjlfkrbye6uqoemcyxmqylwmrm235uclwfpsyx3ge2imidoly"},
+	{"zero 1017", true, 1017, 2048, "fc7e928296e516faade986b28f92d44a4f24b935485223376a799027bc18f833", "baga6ea4seaqpy7usqklokfx2vxuynmupslkeutzexe2uqurdg5vhtebhxqmpqmy"},
+	{"zero 1MiB", true, 1 << 20, 2097152, "d0b530dbb0b4f25c5d2f2a28dfee808b53412a02931f18c499f5a254086b1326", "baga6ea4seaqnbnjq3oylj4s4luxsukg752aiwu2bfibjghyyysm7lisubbvrgjq"},
+	{"patterned 65", false, 65, 128, "fbf5c6b8873ea79fe721958202b3f7eaa99393605ee8c8e988532535090f1238", "baga6ea4seaqpx5ogxcdt5j4744qzlaqcwp36vkmtsnqf52gi5gefgjjvbehreoa"},
+	{"patterned 127", false, 127, 128, "b3c22ed2e440d87a1dfcf2c7c21bc887742acfbba9d00954a0132b99445dc523", "baga6ea4seaqlhqro2lsebwd2dx6pfr6cdpeio5bkz652tuajksqbgk4ziro4kiy"},
+	{"patterned 128", false, 128, 256, "b2bba11fa929911e8a2f530c1a3838d65276f8f6d15f70ca298770f5dca4ca2b", "baga6ea4seaqlfo5bd6ustei6rixvgda2ha4nmutw7d3ncx3qziuyo4hv3ssmuky"},
+	{"patterned 254", false, 254, 256, "c55a789930b816787f45a66512f66ec0399984cdae9476862bb3ae159a47c504", "baga6ea4seaqmkwtyteylqftyp5c2mzis6zxmaomzqtg25fdwqyv3hlqvtjd4kba"},
+	{"patterned 508", false, 508, 512, "77fb93d5bd1c92e8e410e4200df35076ac0f5bcfc9dd3752797759c10af64d34", "baga6ea4seaqhp64t2w6rzexi4qioiian6nihnlaplph4txjxkj4xowobbl3e2na"},
+	{"patterned 1016", false, 1016, 1024, "2c7fb8abf374453dc9bb7a903665bb4fd94609a142dd012e0b358bf7b7ddd827", "baga6ea4seaqcy75yvpzxirj5zg5xvebwmw5u7wkgbgqufxibfyftlc7xw7o5qjy"},
+	{"patterned 1017", false, 1017, 2048, "62a85b6a8077eed2469d44214b0ddb91669a715af8276fbf17a0fa1a5e02b433", "baga6ea4seaqgfkc3nkahp3wsi2ouiiklbxnzczu2ofnpqj3px4l2b6q2lyblimy"},
+	{"patterned 2032", false, 2032, 2048, "77429b76d9579d87cc1a9fdbadd6e3d2d290a37f0d370c60a2ff35ecd3a20306", "baga6ea4seaqhoqu3o3mvphmhzqnj7w5n23r5fuuqun7q2nymmcrp6npm2oragbq"},
+	{"patterned 8128", false, 8128, 8192, "5ec192b52e4712a3822ccb97e5466c12c052918701bc56744ba48fac321a2706", "baga6ea4seaqf5qmswuxeoevdqiwmxf7fizwbfqcssgdqdpcworf2jd5mgincobq"},
+	{"patterned 1MiB", false, 1 << 20, 2097152, "d61488c6e5484d7393f6173b0ce0cc8a0b998c22bd57069a04f4cdc4da751c25", "baga6ea4seaqnmfeiy3suqtltsp3booym4dgiuc4zrqrl2vygticpjtoe3j2ryji"},
+}
+
+func getVectorData(zero bool, size int) []byte {
+	data := make([]byte, size)
+	if !zero {
+		for i := range data {
+			data[i] = byte(i * 7)
+		}
+	}
+
+	return data
+}
+
+func TestCalcCommP(t *testing.T) {
+	for _, vector := range pieceCommitmentVectors {
+		t.Run(vector.name, func(t *testing.T) {
+			data := getVectorData(vector.zero, vector.size)
+			pieceCommitment, err := CalcCommP(bytes.NewReader(data))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if pieceCommitment.PieceCid != vector.pieceCid {
+				t.Errorf("piece cid = %s, want %s", pieceCommitment.PieceCid, vector.pieceCid)
+			}
+			if hex.EncodeToString(pieceCommitment.Commitment) != vector.commitment {
+				t.Errorf("commitment = %x, want %s", pieceCommitment.Commitment, vector.commitment)
+			}
+			if pieceCommitment.PieceSize != vector.pieceSize {
+				t.Errorf("piece size = %d, want %d", pieceCommitment.PieceSize, vector.pieceSize)
+			}
+			if pieceCommitment.PayloadSize != int64(vector.size) {
+				t.Errorf("payload size = %d, want %d", pieceCommitment.PayloadSize, vector.size)
+			}
+		})
+	}
+}
+
+//writes of any size give the same commitment as a single write
+func TestCalculatorWriteSizes(t *testing.T) {
+	for _, writeSize := range []int{1, 31, 126, 127, 128, 1000, 4096} {
+		for _, vector := range pieceCommitmentVectors {
+			data := getVectorData(vector.zero, vector.size)
+			calculator := GetCalculator()
+			for len(data) > 0 {
+				length := writeSize
+				if length > len(data) {
+					length = len(data)
+				}
+				calculator.Write(data[:length])
+				data = data[length:]
+			}
+
+			pieceCommitment, err := calculator.Digest()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if pieceCommitment.PieceCid != vector.pieceCid {
+				t.Errorf("%s in writes of %d: piece cid = %s, want %s", vector.name, writeSize, pieceCommitment.PieceCid, vector.pieceCid)
+			}
+		}
+	}
+}
+
+func TestCalculatorTooLittleData(t *testing.T) {
+	for _, size := range []int{0, 1, MIN_PIECE_PAYLOAD_SIZE - 1} {
+		calculator := GetCalculator()
+		calculator.Write(make([]byte, size))
+		_, err := calculator.Digest()
+		if err == nil {
+			t.Errorf("size %d: error = nil, want an error", size)
+		}
+	}
+}
+
+func TestGetPaddedPieceSize(t *testing.T) {
+	tests := []struct {
+		size            int64
+		paddedPieceSize int64
+	}{
+		{0, 128},
+		{128, 128},
+		{129, 256},
+		{256, 256},
+		{1000, 1024},
+		{1 << 30, 1 << 30},
+		{1<<30 + 1, 1 << 31},
+	}
+
+	for _, test := range tests {
+		paddedPieceSize := GetPaddedPieceSize(test.size)
+		if paddedPieceSize != test.paddedPieceSize {
+			t.Errorf("GetPaddedPieceSize(%d) = %d, want %d", test.size, paddedPieceSize, test.paddedPieceSize)
+		}
+	}
+}
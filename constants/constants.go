@@ -29,8 +29,17 @@ const (
 	CAR_FILE_STATUS_CREATED  = "Created"
 	CAR_FILE_STATUS_ASSIGNED = "Assigned"
 
-	OFFLINE_DEAL_STATUS_ASSIGNED = "Assigned"
-	OFFLINE_DEAL_STATUS_CREATED  = "Created"
+	OFFLINE_DEAL_STATUS_ASSIGNED        = "Assigned"
+	OFFLINE_DEAL_STATUS_CREATED         = "Created"
+	OFFLINE_DEAL_STATUS_WAITING         = "Waiting"
+	OFFLINE_DEAL_STATUS_DOWNLOADING     = "Downloading"
+	OFFLINE_DEAL_STATUS_DOWNLOADED      = "Downloaded"
+	OFFLINE_DEAL_STATUS_DOWNLOAD_FAILED = "DownloadFailed"
+	OFFLINE_DEAL_STATUS_IMPORT_READY    = "ReadyForImport"
+	OFFLINE_DEAL_STATUS_IMPORTING       = "FileImporting"
+	OFFLINE_DEAL_STATUS_IMPORTED        = "FileImported"
+	OFFLINE_DEAL_STATUS_IMPORT_FAILED   = "ImportFailed"
+	OFFLINE_DEAL_STATUS_ACTIVE          = "DealActive"
 
 	EPOCH_PER_HOUR = 120
 
@@ -5,21 +5,25 @@ go 1.16
 require (
 	github.com/dgrijalva/jwt-go v3.2.0+incompatible
 	github.com/filecoin-project/go-dagaggregator-unixfs v0.3.0
+	github.com/gorilla/websocket v1.4.2
+	github.com/ipfs/go-block-format v0.0.3
 	github.com/ipfs/go-blockservice v0.1.7
 	github.com/ipfs/go-cid v0.1.0
 	github.com/ipfs/go-ipfs-api v0.2.0
 	github.com/ipfs/go-ipfs-blockstore v1.0.4
+	github.com/ipfs/go-ipfs-chunker v0.0.5
 	github.com/ipfs/go-ipfs-exchange-offline v0.0.1
 	github.com/ipfs/go-ipfs-files v0.0.8
-	github.com/ipfs/go-ipld-cbor v0.0.4 // indirect
+	github.com/ipfs/go-ipld-cbor v0.0.5
+	github.com/ipfs/go-ipld-format v0.2.0
 	github.com/ipfs/go-merkledag v0.3.2
+	github.com/ipfs/go-unixfs v0.2.6
+	github.com/ipld/go-car/v2 v2.1.0
 	github.com/libp2p/go-libp2p-record v0.1.1 // indirect
-	github.com/mattn/go-isatty v0.0.8
 	github.com/multiformats/go-multihash v0.0.15
 	github.com/rifflock/lfshook v0.0.0-20180920164130-b9218ef580f5
 	github.com/shopspring/decimal v1.3.1
 	github.com/sirupsen/logrus v1.8.1
 	github.com/syndtr/goleveldb v1.0.0
-	golang.org/x/sys v0.0.0-20210615035016-665e8c7367d1
 	golang.org/x/xerrors v0.0.0-20200804184101-5ec99f83aff1
 )
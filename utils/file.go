@@ -2,6 +2,8 @@ package utils
 
 import (
 	"bufio"
+	"crypto/md5"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
@@ -105,6 +107,25 @@ func GetFileSize2(dir, fileName string) int64 {
 	return fi.Size()
 }
 
+//reads the file as a stream and returns its md5 in lower case hex
+func GetFileMd5(filePath string) (string, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return "", err
+	}
+	defer file.Close()
+
+	hash := md5.New()
+	_, err = io.Copy(hash, file)
+	if err != nil {
+		logs.GetLogger().Error(err)
+		return "", err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
 func CopyFile(srcFilePath, destFilePath string) (int64, error) {
 	sourceFileStat, err := os.Stat(srcFilePath)
 	if err != nil {